@@ -32,33 +32,26 @@ type ParsedArticle struct {
 	Date         time.Time         // Date header (already parsed)
 }
 
-// Returns all saved articles from „group“ and the paths of
-// their files.
-func GetArticles(group string) ([]RawArticle, []string, error) {
-	info, err := ioutil.ReadDir(group)
+// Returns all saved articles from „group“ and their names.
+func GetArticles(store ArticleStore, group string) ([]RawArticle, []string, error) {
+	names, err := store.List(group)
 
 	if err != nil {
 		return nil, nil, err
 	}
 
-	rv := make([]RawArticle, 0)
-	paths := make([]string, 0)
-	for _, fileInfo := range info {
-		name := fileInfo.Name()
-		if name[0] != '.' { // ignore .watermark
-			name = group + "/" + fileInfo.Name()
-			data, err := ioutil.ReadFile(name)
+	rv := make([]RawArticle, 0, len(names))
+	for _, name := range names {
+		article, err := store.Get(group, name)
 
-			if err != nil {
-				return nil, nil, err
-			}
-
-			rv = append(rv, RawArticle(data))
-			paths = append(paths, name)
+		if err != nil {
+			return nil, nil, err
 		}
+
+		rv = append(rv, article)
 	}
 
-	return rv, paths, err
+	return rv, names, nil
 }
 
 // Separates body and headers; determines subject, references
@@ -84,6 +77,11 @@ func FormatArticle(article RawArticle) ParsedArticle {
 		buf = buf + line + "\n"
 	}
 
+	// don't forget last header
+	if len(buf) > 0 {
+		joinedHeaders = append(joinedHeaders, TrimWhite(buf))
+	}
+
 	// all headers
 	headers := make(map[string]string)
 
@@ -217,26 +215,7 @@ func FormatArticle(article RawArticle) ParsedArticle {
 
 	var aTime time.Time
 	if date, ok := headers["Date"]; ok {
-		// we found all these date formats in our corpus,
-		// containing 40000+ messages from comp.lang.forth
-		// comp.lang.lisp, comp.lang.haskell and
-		// rec.games.abstract
-		layouts := []string{
-			"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-			"Mon, 2 Jan 2006 15:04:05 -0700",
-			"Mon, 2 Jan 2006 15:04:05 MST",
-			"Mon, 2 Jan 2006 15:04:05 -0700 (MST-07:00)",
-			"2 Jan 2006 15:04:05 -0700",
-			"2 Jan 2006 15:04:05 MST",
-			"Mon, 2 Jan 2006 15:04 -0700",
-		}
-
-		for _, layout := range layouts {
-			aTime, err = time.Parse(layout, date)
-			if err == nil {
-				break
-			}
-		}
+		aTime = parseDate(date)
 	}
 
 	return ParsedArticle{
@@ -249,6 +228,33 @@ func FormatArticle(article RawArticle) ParsedArticle {
 	}
 }
 
+// Parses the value of a Date header. Returns the zero time if
+// this doesn't work.
+func parseDate(date string) time.Time {
+	// we found all these date formats in our corpus,
+	// containing 40000+ messages from comp.lang.forth
+	// comp.lang.lisp, comp.lang.haskell and
+	// rec.games.abstract
+	layouts := []string{
+		"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"Mon, 2 Jan 2006 15:04:05 -0700 (MST-07:00)",
+		"2 Jan 2006 15:04:05 -0700",
+		"2 Jan 2006 15:04:05 MST",
+		"Mon, 2 Jan 2006 15:04 -0700",
+	}
+
+	for _, layout := range layouts {
+		aTime, err := time.Parse(layout, date)
+		if err == nil {
+			return aTime
+		}
+	}
+
+	return time.Time{}
+}
+
 // example: firstAndRest("this: is: an example", ": ") → "this",
 // "is: an example"
 func firstAndRest(str, sep string) (first, rest string) {
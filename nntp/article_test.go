@@ -0,0 +1,19 @@
+package nntp
+
+import (
+	"testing"
+)
+
+// The last header used to be dropped when parsing.
+func TestFormatArticleHeaders(t *testing.T) {
+	article := FormatArticle("Subject: first\nFrom: Jane <jane@example.org>\nMessage-ID: <last@test>\n\nbody")
+	if article.Subject != "first" || article.Id != "<last@test>" || article.Body != "body" {
+		t.Errorf("wrongly parsed: %+v", article)
+	}
+
+	// folded (see RFC 3977, 3.6)
+	article = FormatArticle("Message-ID: <1@test>\nReferences: <a@test>\n <b@test>\n\nbody")
+	if len(article.References) != 2 || article.References[1] != "<b@test>" {
+		t.Errorf("folded last header wrongly parsed: %+v", article.References)
+	}
+}
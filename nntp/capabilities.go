@@ -0,0 +1,87 @@
+package nntp
+
+import (
+	"strings"
+)
+
+// Capabilities as advertised by the server (see RFC 3977, 5.2).
+// Maps the capability label (in upper case, e. g. „OVER“ or
+// „AUTHINFO“) to its arguments.
+type Capabilities map[string][]string
+
+// Does the server advertise label (e. g. „READER“)?
+func (caps Capabilities) Has(label string) bool {
+	_, ok := caps[strings.ToUpper(label)]
+	return ok
+}
+
+// Does the server advertise label with the argument arg (e. g.
+// „AUTHINFO“ with „USER“)?
+func (caps Capabilities) HasArgument(label, arg string) bool {
+	for _, a := range caps[strings.ToUpper(label)] {
+		if strings.EqualFold(a, arg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Capabilities of the server. This is nil if the server doesn't
+// understand CAPABILITIES (e. g. because it predates RFC 3977);
+// in this case, we assume it supports the usual reader commands.
+func (c *Client) Capabilities() Capabilities {
+	return c.caps
+}
+
+// Asks the server for its capabilities. Should be done again
+// whenever they might have changed (after STARTTLS, MODE READER
+// and authentication).
+func (c *Client) refreshCapabilities() error {
+	_, _, err := c.cmd(CAPABILITIES_FOLLOW, "CAPABILITIES")
+
+	if _, ok := err.(*Error); ok {
+		// not implemented by this server
+		c.caps = nil
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	lines, err := c.conn.ReadDotLines()
+	if err != nil {
+		return err
+	}
+
+	c.caps = make(Capabilities)
+	for _, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) > 0 {
+			c.caps[strings.ToUpper(parts[0])] = parts[1:]
+		}
+	}
+
+	return nil
+}
+
+// Makes sure the server is in reader mode. Servers that don't
+// tell their capabilities might still need MODE READER, so it's
+// sent to them as well (and errors are ignored).
+func (c *Client) modeReader() error {
+	if c.caps.Has("READER") || (c.caps != nil && !c.caps.Has("MODE-READER")) {
+		return nil
+	}
+
+	_, _, err := c.cmd(HELLO/10, "MODE READER") // 200 or 201
+	if _, ok := err.(*Error); ok && c.caps == nil {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.refreshCapabilities()
+}
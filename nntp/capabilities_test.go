@@ -0,0 +1,140 @@
+package nntp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kedorlaomer/loread/nntp/nntptest"
+)
+
+// Makes server record the commands it gets (see
+// nntptest.FaultFunc), refusing those starting with one of
+// refused; the returned function gives them.
+func recordCommands(server *nntptest.Server, refused ...string) func() []string {
+	var mu sync.Mutex
+	commands := make([]string, 0)
+	server.SetFault(func(connection int, line string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		commands = append(commands, line)
+		for _, r := range refused {
+			if line != "" && strings.HasPrefix(line, r) {
+				return "500 unknown command", false
+			}
+		}
+
+		return "", false
+	})
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), commands...)
+	}
+}
+
+// How often command was sent.
+func countCommand(commands []string, command string) int {
+	rv := 0
+	for _, c := range commands {
+		if c == command {
+			rv++
+		}
+	}
+
+	return rv
+}
+
+// A server predating RFC 3977 gets MODE READER anyway, and the
+// usual reader commands are assumed to work.
+func TestNoCapabilities(t *testing.T) {
+	server := newTestServer(t, 3)
+	defer server.Close()
+	commands := recordCommands(server, "CAPABILITIES")
+
+	client, err := connect(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if client.Capabilities() != nil || !client.CanAuthenticate() {
+		t.Errorf("capabilities %v without CAPABILITIES", client.Capabilities())
+	}
+
+	if countCommand(commands(), "MODE READER") != 1 {
+		t.Errorf("MODE READER not sent: %q", commands())
+	}
+
+	if _, _, _, err := client.Group("test.group"); err != nil {
+		t.Error(err)
+	}
+
+	if records, err := client.Overview(1, 3); err != nil || len(records) != 3 {
+		t.Errorf("OVER gives %+v (%v)", records, err)
+	}
+}
+
+// A server advertising MODE-READER is switched to reader mode,
+// and its capabilities are asked for again.
+func TestModeReader(t *testing.T) {
+	server := newTestServer(t, 3)
+	defer server.Close()
+	commands := recordCommands(server)
+
+	// already a reader: no MODE READER
+	client, err := connect(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if countCommand(commands(), "MODE READER") != 0 {
+		t.Errorf("MODE READER sent to a reader: %q", commands())
+	}
+
+	server.SetTransit(true)
+	commands = recordCommands(server)
+	client, err = connect(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if countCommand(commands(), "MODE READER") != 1 || countCommand(commands(), "CAPABILITIES") != 2 {
+		t.Errorf("wrong commands: %q", commands())
+	}
+
+	if caps := client.Capabilities(); !caps.Has("READER") || caps.Has("MODE-READER") || !caps.Has("OVER") {
+		t.Errorf("capabilities %v not refreshed after MODE READER", caps)
+	}
+
+	if _, _, _, err := client.Group("test.group"); err != nil {
+		t.Error(err)
+	}
+}
+
+// AUTHINFO isn't advertised any more after authenticating.
+func TestCapabilitiesAfterAuth(t *testing.T) {
+	server := newTestServer(t, 1)
+	defer server.Close()
+	server.SetAuth("user", "secret")
+	commands := recordCommands(server)
+
+	client, err := connect(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if countCommand(commands(), "CAPABILITIES") != 2 {
+		t.Errorf("capabilities not refreshed: %q", commands())
+	}
+
+	if client.Capabilities().Has("AUTHINFO") || client.CanAuthenticate() {
+		t.Errorf("stale capabilities %v after AUTHINFO", client.Capabilities())
+	}
+}
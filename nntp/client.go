@@ -3,19 +3,27 @@ package nntp
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/textproto"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // NNTP protocol codes (see RFC 3977; https://tools.ietf.org/html/rfc3977)
 const (
-	HELLO             = 200
-	PASSWORD_REQUIRED = 381
-	AUTHEN_ACCEPTED   = 281
-	OK                = 211 // generic OK
+	HELLO               = 200
+	HELLO_NO_POSTING    = 201
+	CAPABILITIES_FOLLOW = 101
+	PASSWORD_REQUIRED   = 381
+	AUTHEN_ACCEPTED     = 281
+	OK                  = 211 // generic OK
+	CONTINUE_TLS        = 382 // see RFC 4642
+	GOODBYE             = 205
+	ARTICLE_FOLLOWS     = 220
+	HEAD_FOLLOWS        = 221
+	BODY_FOLLOWS        = 222
 )
 
 const PERM_MASK = 0777 // for our own files
@@ -27,140 +35,180 @@ const (
 	CODE_RESET  = "\x1B[39m" // reset
 )
 
-var verbose bool
-
 type Conn struct {
-	intern *textproto.Conn
+	intern  *textproto.Conn
+	raw     net.Conn      // underlying connection (maybe encrypted)
+	verbose bool          // print the transcript?
+	timeout time.Duration // for each read or write; 0 means none
 }
 
-// Fetches articles as specified in the configuration.
-func FetchArticles(config map[string]string) {
-	network := "tcp"
-	server, port := config["server"], config["port"]
-	username, passw := config["login"], config["pass"]
-	fetchMaximum := atoi(config["fetch-maximum"], 100) // reasonable (?) default
-	_, verbose = config["verbose"]
-
-	if server == "" || port == "" {
-		log.Fatal("Port or server not given. Config says: server = '%s', port = '%s'\n",
-			server, port)
-	}
+// A connection to an NNTP server speaking the reader commands we
+// need. Its methods don't terminate the program; errors caused by
+// the server's reply are of type *Error.
+type Client struct {
+	conn Conn
+	caps Capabilities // see Capabilities
+}
 
-	if username == "" {
-		log.Fatal("Username not given.\n")
-	}
+// An unexpected reply from the server.
+type Error struct {
+	Code    int    // NNTP status code, e. g. 411 (no such group)
+	Message string // rest of the status line
+}
 
-	addr := config["server"] + ":" + config["port"]
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
 
-	// connect
-	conn1, err := textproto.Dial(network, addr)
-	die(err, "Couldn't dial %s (error: %s)", network, err)
-	conn := Conn{conn1}
+// Connects to the server given in config (keys „server“, „port“,
+// „tls“ etc.; see README.md), reads its greeting, asks for its
+// capabilities and switches to reader mode, if necessary.
+func Dial(config map[string]string) (*Client, error) {
+	conn, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
 
-	defer conn.Close()
+	c := &Client{conn: conn}
 
-	// say hello
-	code, message, err := conn.ReadCodeLine(HELLO)
-	die(err, "Couldn't connect to server. Error %d, message %s.\n", code, message)
-	_, err = conn.Cmd("AUTHINFO USER %s", username)
-	die(err, "Didn't like AUTHINFO USER (%s)\n", err)
+	err = c.refreshCapabilities()
+	if err == nil {
+		err = c.modeReader()
+	}
 
-	// authenticate
-	code, message, err = conn.ReadCodeLine(PASSWORD_REQUIRED)
-	if code != PASSWORD_REQUIRED && code != AUTHEN_ACCEPTED {
-		die(err, "unexpected code: %d (%s) (%s)\n", code, message, err)
+	if err != nil {
+		c.Close()
+		return nil, err
 	}
 
+	return c, nil
+}
+
+// Sends AUTHINFO USER and, if requested, AUTHINFO PASS.
+func (c *Client) Authenticate(username, password string) error {
+	code, _, err := c.cmd(PASSWORD_REQUIRED, "AUTHINFO USER %s", username)
+
 	if code == PASSWORD_REQUIRED {
-		_, err = conn.Cmd("AUTHINFO PASS %s", passw)
-		die(err, "Didn't like AUTHINFO PASSW (%s)\n", err)
-		code, message, err = conn.ReadCodeLine(AUTHEN_ACCEPTED)
-		die(err, "Didn't like AUTHINFO PASSW (%s) (%s)\n", message, err)
+		_, _, err = c.cmd(AUTHEN_ACCEPTED, "AUTHINFO PASS %s", password)
+	} else if code == AUTHEN_ACCEPTED {
+		err = nil
 	}
 
-	groups := strings.Split(config["groups"], ", ")
-	if len(groups) == 0 {
-		log.Fatal("No groups given.\n")
+	if err != nil {
+		return err
 	}
 
-	// fetch articles
-	for _, g := range groups {
-		err = os.Mkdir(g, PERM_MASK) // everyone may read/write this
-		if err != nil && !os.IsExist(err) {
-			die(err, "Couldn't create directory %s (%s)", g, err.Error())
-		}
+	// capabilities may change after authentication
+	return c.refreshCapabilities()
+}
 
-		// select group; get server's watermark
-		_, err = conn.Cmd("GROUP %s", g)
-		die(err, "Couldn't choose group %s", g)
-		code, message, err = conn.ReadCodeLine(OK)
-		die(err, "Couldn't choose group %s", g)
+// Should we authenticate? False if the server tells us that
+// AUTHINFO isn't available (any more).
+func (c *Client) CanAuthenticate() bool {
+	return c.caps == nil || c.caps.Has("AUTHINFO")
+}
 
-		parts := strings.Split(message, " ")
-		if len(parts) != 4 {
-			log.Fatal("Expected four parts, but got '%s' with %d parts", message, len(parts))
-		}
+// Selects group. Returns the server's estimate of the number of
+// articles and its low and high watermark.
+func (c *Client) Group(group string) (number, lo, hi int, err error) {
+	_, message, err := c.cmd(OK, "GROUP %s", group)
+	if err != nil {
+		return
+	}
 
-		number := atoi(parts[0], -1)
-		lo, hi := atoi(parts[1], -1), atoi(parts[2], -1)
+	parts := strings.Split(message, " ")
+	if len(parts) != 4 {
+		err = fmt.Errorf("expected four parts, but got '%s' with %d parts", message, len(parts))
+		return
+	}
 
-		if number < 0 || lo < 0 || hi < 0 {
-			log.Fatal("Server answered: %d, %d, %d", number, lo, hi)
-		}
+	number = atoi(parts[0], -1)
+	lo, hi = atoi(parts[1], -1), atoi(parts[2], -1)
 
-		watermark := GetWatermark(g)
+	if number < 0 || lo < 0 || hi < 0 {
+		err = fmt.Errorf("malformed reply to GROUP: %s", message)
+	}
 
-		// we can't catch up with server anymore because we are
-		// too far behind
-		if watermark < lo {
-			watermark = lo
-		}
+	return
+}
 
-		// get a list of article numbers
-		_, err = conn.Cmd("LISTGROUP %s %d-", g, watermark+1)
-		die(err, "Couldn't list group %s", g)
-		articles, err := conn.ReadDotLines()
-		die(err, "Couldn't list group %s", g)
-		articles = articles[1:]
+// Selects group and lists the numbers of its articles starting
+// at from.
+func (c *Client) ListGroup(group string, from int) ([]int, error) {
+	_, _, err := c.cmd(OK, "LISTGROUP %s %d-", group, from)
+	if err != nil {
+		return nil, err
+	}
 
-		// get only the last fetchMaximum articles
-		if len(articles) > fetchMaximum {
-			articles = articles[len(articles)-fetchMaximum:]
+	lines, err := c.conn.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]int, 0, len(lines))
+	for _, line := range lines {
+		if no := atoi(TrimWhite(line), -1); no >= 0 {
+			rv = append(rv, no)
 		}
+	}
 
-		// number of last read article
-		lastRead := watermark
+	return rv, nil
+}
 
-		// save articles
-		for _, no := range articles {
-			err = fetchArticle(conn, g, no)
-			lastRead = atoi(no, lastRead)
-			if err != nil {
-				break
-			}
-		}
+// Retrieves the article given by spec, which is either an article
+// number in the current group or a message id.
+func (c *Client) Article(spec string) (RawArticle, error) {
+	text, err := c.multiline(ARTICLE_FOLLOWS, "ARTICLE %s", spec)
+	return RawArticle(text), err
+}
 
-		if len(articles) == 0 {
-			lastRead = hi
-		} else {
-			lastRead = atoi(articles[len(articles)-1], hi)
-		}
+// Like Article, but retrieves only the headers.
+func (c *Client) Head(spec string) (RawArticle, error) {
+	text, err := c.multiline(HEAD_FOLLOWS, "HEAD %s", spec)
+	return RawArticle(text), err
+}
 
-		if watermark > lastRead {
-			lastRead = watermark
-		}
+// Like Article, but retrieves only the (undecoded) body.
+func (c *Client) Body(spec string) (string, error) {
+	return c.multiline(BODY_FOLLOWS, "BODY %s", spec)
+}
+
+// Says good bye and closes the connection.
+func (c *Client) Quit() error {
+	_, _, err := c.cmd(GOODBYE, "QUIT")
+	c.Close()
+	return err
+}
+
+// Closes the connection without saying good bye.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
 
-		SetWatermark(g, lastRead)
+// Sends a command and reads the status line, which should have
+// code expected. The response is sequenced with textproto's
+// Pipeline, so that it doesn't get in the way of Pipeline.
+func (c *Client) cmd(expected int, format string, args ...interface{}) (int, string, error) {
+	id, err := c.conn.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
 	}
 
-	// is allowed to fail
-	conn.Cmd("QUIT")
+	c.conn.intern.StartResponse(id)
+	defer c.conn.intern.EndResponse(id)
+	return c.conn.ReadCodeLine(expected)
 }
 
-func die(err error, format string, args ...interface{}) {
+// Like cmd, but also reads the following multi-line block and
+// joins its lines with '\n'.
+func (c *Client) multiline(expected int, format string, args ...interface{}) (string, error) {
+	_, _, err := c.cmd(expected, format, args...)
 	if err != nil {
-		log.Fatal(format, args)
+		return "", err
 	}
+
+	lines, err := c.conn.ReadDotLines()
+	return strings.Join(lines, "\n"), err
 }
 
 // Converts str into an int. Returns n if str is malformed.
@@ -173,52 +221,86 @@ func atoi(str string, n int) int {
 	return rv
 }
 
-// Reads the file „groupname“/.watermark which should contain a number. This
-// should be the last message read. Returns this number (or 0,
-// if there's no such number).
-func GetWatermark(groupname string) int {
-	name := groupname + "/.watermark"
-
-	everything, err := ioutil.ReadFile(name)
+// Reads the file „group“/.gaps, which contains the numbers of
+// articles we failed to fetch from server (see Ranges).
+func GetGaps(store ArticleStore, group, server string) Ranges {
+	everything, err := store.ReadData(group, serverFile(".gaps", server))
 
 	if err != nil {
-		return 0
+		return nil
 	}
 
-	number := strings.TrimSpace(string(everything))
-	return atoi(number, 0)
+	return ParseRanges(string(everything))
 }
 
-// See GetWatermark.
-func SetWatermark(groupname string, messageNo int) error {
-	filename := groupname + "/.watermark"
-	data := []byte(strconv.Itoa(messageNo))
-	return ioutil.WriteFile(filename, data, PERM_MASK)
+// See GetGaps.
+func SetGaps(store ArticleStore, group, server string, gaps Ranges) error {
+	return store.WriteData(group, serverFile(".gaps", server), []byte(gaps.String()))
 }
 
-// Saves article „messageNo“ from „groupname“ that has the text
-// „content“. Should contain both header and article text.
-func WriteArticle(groupname string, messageNo string, content string) error {
-	filename := groupname + "/" + messageNo
-	data := []byte(content)
-	return ioutil.WriteFile(filename, data, PERM_MASK)
+// Name of the file name belonging to server (the name of its
+// section; see Servers). With a single server, this is just name;
+// otherwise, e. g. „.watermark.free“.
+func serverFile(name, server string) string {
+	if server == "" {
+		return name
+	}
+
+	return name + "." + server
+}
+
+// Name of the file in which article number no from server is
+// saved.
+func ArticleName(no int, server string) string {
+	return serverFile(strconv.Itoa(no), server)
+}
+
+// Inverse of ArticleName; the number is -1 for other names.
+func splitArticleName(name string) (no int, server string) {
+	number, server := firstAndRest(name, ".")
+	return atoi(number, -1), server
+}
+
+// Like ioutil.WriteFile, but writes to a temporary file first
+// and renames it, so readers see either the old or the new
+// content.
+func writeFileAtomically(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	err := ioutil.WriteFile(tmp, data, PERM_MASK)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
 }
 
 // Like fmt.Printf, but only if verbose was set in the config
 // file.
-func printVerbosely(format string, args ...interface{}) {
-	if verbose {
+func (conn Conn) printVerbosely(format string, args ...interface{}) {
+	if conn.verbose {
 		fmt.Printf(format, args...)
 	}
 }
 
 // We wrap textproto.Conn's functions with verbose (and
 // colorful) printing, if „verbose“ is set in the config file.
+// Arguments often come from the outside (e. g. a search text), so
+// a command containing a line break, which would smuggle in
+// another command, isn't sent.
 func (conn Conn) Cmd(format string, args ...interface{}) (id uint, err error) {
-	printVerbosely(CODE_OUTPUT)
-	defer printVerbosely(CODE_RESET)
-	printVerbosely(format+"\n", args...)
-	id, err = conn.intern.Cmd(format, args...)
+	line := fmt.Sprintf(format, args...)
+	if strings.ContainsAny(line, "\r\n") {
+		command, _ := firstAndRest(line, " ")
+		return 0, fmt.Errorf("line break in the arguments of %s", command)
+	}
+
+	conn.printVerbosely(CODE_OUTPUT)
+	defer conn.printVerbosely(CODE_RESET)
+	conn.printVerbosely("%s\n", line)
+	if conn.timeout > 0 {
+		conn.raw.SetWriteDeadline(time.Now().Add(conn.timeout))
+	}
+	id, err = conn.intern.Cmd("%s", line)
 	return
 }
 
@@ -226,42 +308,37 @@ func (conn Conn) Close() error {
 	return conn.intern.Close()
 }
 
+// Unexpected codes are reported as *Error.
 func (conn Conn) ReadCodeLine(expected int) (code int, message string, err error) {
+	conn.setReadDeadline()
 	code, message, err = conn.intern.ReadCodeLine(expected)
-	printVerbosely(CODE_INPUT)
-	defer printVerbosely(CODE_RESET)
-	printVerbosely("(code %d) %s\n", code, message)
+	conn.printVerbosely(CODE_INPUT)
+	defer conn.printVerbosely(CODE_RESET)
+	conn.printVerbosely("(code %d) %s\n", code, message)
+
+	if _, ok := err.(*textproto.Error); ok {
+		err = &Error{code, message}
+	}
 	return
 }
 
 func (conn Conn) ReadDotLines() (lines []string, err error) {
+	conn.setReadDeadline()
 	lines, err = conn.intern.ReadDotLines()
-	printVerbosely(CODE_INPUT)
-	defer printVerbosely(CODE_RESET)
+	conn.printVerbosely(CODE_INPUT)
+	defer conn.printVerbosely(CODE_RESET)
 	if len(lines) > 0 {
 		for _, line := range lines {
-			printVerbosely("%s\n", line)
+			conn.printVerbosely("%s\n", line)
 		}
 	}
 	return
 }
 
-func fetchArticle(conn Conn, group string, no string) error {
-	_, err := conn.Cmd("ARTICLE %s", no)
-
-	if err != nil {
-		return err
+// A server that doesn't answer within conn.timeout is considered
+// gone.
+func (conn Conn) setReadDeadline() {
+	if conn.timeout > 0 {
+		conn.raw.SetReadDeadline(time.Now().Add(conn.timeout))
 	}
-
-	lines, err := conn.ReadDotLines()
-	if err != nil {
-		return err
-	}
-
-	if err != nil {
-		return err
-	}
-
-	article := strings.Join(lines[1:], "\n") // first line is error code etc.
-	return WriteArticle(group, no, article)
 }
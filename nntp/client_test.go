@@ -0,0 +1,143 @@
+package nntp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kedorlaomer/loread/nntp/nntptest"
+)
+
+// the current directory (see inTempDir)
+var testStore = DirStore{}
+
+// A test server with the articles 1…n in test.group; the nth
+// article is a reply to the first one.
+func newTestServer(t *testing.T, n int) *nntptest.Server {
+	server, err := nntptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for no := 1; no <= n; no++ {
+		refs := ""
+		if no == n && n > 1 {
+			refs = "References: <1@test>\n"
+		}
+
+		server.AddArticle("test.group", no, fmt.Sprintf(
+			"From: Jane <jane@example.org>\nNewsgroups: test.group\n"+
+				"Subject: article %d\nDate: Mon, 2 Jan 2006 15:04:05 -0700\n"+
+				"Message-ID: <%d@test>\n%s\nbody of %d", no, no, refs, no))
+	}
+
+	return server
+}
+
+// Changes to a new temporary directory (where the group
+// directories are created); returns a function that undoes
+// this.
+func inTempDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "loread")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := newTestServer(t, 3)
+	defer server.Close()
+	server.SetAuth("user", "secret")
+
+	client, err := Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if !client.Capabilities().HasArgument("AUTHINFO", "USER") {
+		t.Errorf("AUTHINFO USER not advertised: %v", client.Capabilities())
+	}
+
+	// not yet authenticated
+	_, _, _, err = client.Group("test.group")
+	if e, ok := err.(*Error); !ok || e.Code != 480 {
+		t.Errorf("expected 480 before authentication, got %v", err)
+	}
+
+	if err = client.Authenticate("user", "wrong"); err == nil {
+		t.Errorf("wrong password accepted")
+	}
+
+	if err = client.Authenticate("user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.CanAuthenticate() {
+		t.Errorf("AUTHINFO still advertised after authentication")
+	}
+
+	_, _, _, err = client.Group("no.such.group")
+	if e, ok := err.(*Error); !ok || e.Code != 411 {
+		t.Errorf("expected 411 for a missing group, got %v", err)
+	}
+
+	number, lo, hi, err := client.Group("test.group")
+	if err != nil || number != 3 || lo != 1 || hi != 3 {
+		t.Errorf("GROUP gives %d %d %d (%v)", number, lo, hi, err)
+	}
+
+	numbers, err := client.ListGroup("test.group", 2)
+	if err != nil || len(numbers) != 2 || numbers[0] != 2 {
+		t.Errorf("LISTGROUP gives %v (%v)", numbers, err)
+	}
+
+	article, err := client.Article("2")
+	if err != nil || !strings.HasSuffix(string(article), "body of 2") {
+		t.Errorf("ARTICLE gives %q (%v)", article, err)
+	}
+
+	article, err = client.Article("<3@test>")
+	if err != nil || FormatArticle(article).References[0] != "<1@test>" {
+		t.Errorf("ARTICLE by message id gives %q (%v)", article, err)
+	}
+
+	head, err := client.Head("1")
+	if err != nil || strings.Contains(string(head), "body") {
+		t.Errorf("HEAD gives %q (%v)", head, err)
+	}
+
+	body, err := client.Body("1")
+	if err != nil || body != "body of 1" {
+		t.Errorf("BODY gives %q (%v)", body, err)
+	}
+
+	_, err = client.Article("17")
+	if !IsNoSuchArticle(err) {
+		t.Errorf("expected 423 for a missing article, got %v", err)
+	}
+
+	records, err := client.Overview(1, 3)
+	if err != nil || len(records) != 3 || records[2].References != "<1@test>" {
+		t.Errorf("OVER gives %v (%v)", records, err)
+	}
+
+	// 423, since there are no such articles
+	if records, err := client.Overview(10, 20); err != nil || len(records) != 0 {
+		t.Errorf("OVER of an empty range gives %v (%v)", records, err)
+	}
+
+	if err = client.Quit(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,62 @@
+package nntp
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+	"net/textproto"
+)
+
+// NNTP protocol code for COMPRESS (see RFC 8054)
+const COMPRESSION_ACTIVE = 206
+
+// Is COMPRESS DEFLATE advertised in the server's capabilities?
+func (c *Client) CanCompress() bool {
+	return c.caps.HasArgument("COMPRESS", "DEFLATE")
+}
+
+// Sends COMPRESS DEFLATE; afterwards, everything is compressed in
+// both directions (see RFC 8054). The verbose transcript still
+// shows the uncompressed commands and responses.
+func (c *Client) Compress() error {
+	_, _, err := c.cmd(COMPRESSION_ACTIVE, "COMPRESS DEFLATE")
+	if err != nil {
+		return err
+	}
+
+	c.conn.intern = textproto.NewConn(newDeflateConn(c.conn.raw))
+	return c.refreshCapabilities()
+}
+
+// Reads and writes raw DEFLATE streams (RFC 1951) on conn.
+type deflateConn struct {
+	conn net.Conn
+	r    io.ReadCloser
+	w    *flate.Writer
+}
+
+func newDeflateConn(conn net.Conn) *deflateConn {
+	// can't fail for a valid level
+	w, _ := flate.NewWriter(conn, flate.DefaultCompression)
+	return &deflateConn{conn, flate.NewReader(conn), w}
+}
+
+func (d *deflateConn) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Everything written is flushed immediately, since the other
+// side waits for complete commands or responses.
+func (d *deflateConn) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, d.w.Flush()
+}
+
+func (d *deflateConn) Close() error {
+	d.r.Close()
+	return d.conn.Close()
+}
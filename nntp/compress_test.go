@@ -0,0 +1,56 @@
+package nntp
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 20)
+	defer server.Close()
+	server.SetCompress(true)
+
+	config := server.Config()
+	config["compress"] = "no"
+	client, err := connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !client.CanCompress() {
+		t.Errorf("COMPRESS DEFLATE not advertised")
+	}
+	client.Close()
+
+	// the server stops advertising COMPRESS once it's active
+	delete(config, "compress")
+	client, err = connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.CanCompress() {
+		t.Errorf("compression not active")
+	}
+
+	article, err := client.Article("<17@test>")
+	if err != nil || FormatArticle(article).Body != "body of 17" {
+		t.Errorf("ARTICLE gives %q (%v)", article, err)
+	}
+	client.Close()
+
+	// pipelined
+	config["groups"] = "test.group"
+	config["pipeline-window"] = "4"
+	if err = FetchArticles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for no := 1; no <= 20; no++ {
+		if !testStore.Has("test.group", strconv.Itoa(no)) {
+			t.Errorf("article %d is missing", no)
+		}
+	}
+}
@@ -3,6 +3,10 @@
 // preferred format:
 //
 // key: value
+//
+// Several servers can be configured in sections starting with a
+// line like „[name]“; see Servers. Credentials needn't be written
+// into the file; see resolveCredentials.
 
 package nntp
 
@@ -11,10 +15,21 @@ import (
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func ReadConfig(filename string) (config map[string]string, err error) {
+func ReadConfig(filename string) (map[string]string, error) {
+	config, err := readConfig(filename)
+	if err != nil {
+		return config, err
+	}
+
+	return config, resolveCredentials(config)
+}
+
+func readConfig(filename string) (config map[string]string, err error) {
 	const SEP = ": "
 	const LEN = len(SEP)
 	config = make(map[string]string, 50)
@@ -27,19 +42,31 @@ func ReadConfig(filename string) (config map[string]string, err error) {
 	defer file.Close()
 	lineReader := bufio.NewReader(file)
 
+	// keys of section „name“ are saved as „name/key“
+	section := ""
+
 	for line, err2 := lineReader.ReadString('\n'); line != ""; line, err2 = lineReader.ReadString('\n') {
 		i := strings.Index(line, SEP)
 
-		if i == -1 {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = trimmed[1 : len(trimmed)-1]
+			if config["sections"] != "" {
+				config["sections"] += ", "
+			}
+			config["sections"] += section
+		} else if i == -1 {
 			log.Printf("config.Read: error in config file %s\n", filename)
 			continue
+		} else {
+			key, value := line[:i], line[i+LEN:]
+			key = strings.TrimSpace(key)
+			value = strings.TrimSpace(value)
+			if section != "" {
+				key = section + "/" + key
+			}
+			config[key] = value
 		}
 
-		key, value := line[:i], line[i+LEN:]
-		key = strings.TrimSpace(key)
-		value = strings.TrimSpace(value)
-		config[key] = value
-
 		if err2 == io.EOF {
 			err = nil
 			return
@@ -53,3 +80,63 @@ func ReadConfig(filename string) (config map[string]string, err error) {
 
 	return
 }
+
+// The configurations of all servers. Without sections, this is
+// just config. Otherwise, every section is a server; keys
+// before the first section apply to all of them, unless the
+// section has its own. The section's name is saved as „section“.
+func Servers(config map[string]string) []map[string]string {
+	if config["sections"] == "" {
+		return []map[string]string{config}
+	}
+
+	rv := make([]map[string]string, 0)
+	for _, name := range strings.Split(config["sections"], ", ") {
+		rv = append(rv, Server(config, name))
+	}
+
+	return rv
+}
+
+// The configuration of the server from section name (see
+// Servers). For "", this is the first server, which is used for
+// posting and the group list.
+func Server(config map[string]string, name string) map[string]string {
+	if config["sections"] == "" || config["section"] != "" {
+		return config
+	}
+
+	if name == "" {
+		name, _ = firstAndRest(config["sections"], ", ")
+	}
+
+	rv := make(map[string]string)
+	for key, value := range config {
+		if !strings.Contains(key, "/") && key != "sections" {
+			rv[key] = value
+		}
+	}
+
+	prefix := name + "/"
+	for key, value := range config {
+		if strings.HasPrefix(key, prefix) {
+			rv[key[len(prefix):]] = value
+		}
+	}
+
+	rv["section"] = name
+	return rv
+}
+
+// Parses an age like „30d“ (days) or anything time.ParseDuration
+// understands, e. g. „12h“.
+func ParseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(age[:len(age)-1])
+		if err == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+
+	return time.ParseDuration(age)
+}
@@ -0,0 +1,80 @@
+package nntp
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestReadConfigSections(t *testing.T) {
+	defer inTempDir(t)()
+
+	err := ioutil.WriteFile("config.txt", []byte("from: Jane <jane@example.org>\n"+
+		"groups: comp.lang.lisp\n[free]\nserver: free.example.org\n"+
+		"[paid]\nserver: paid.example.org\ngroups: alt.test\n"), PERM_MASK)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig("config.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := Servers(config)
+	if len(servers) != 2 {
+		t.Fatalf("expected 2 servers, got %v", servers)
+	}
+
+	free, paid := servers[0], servers[1]
+	if free["section"] != "free" || free["server"] != "free.example.org" || free["groups"] != "comp.lang.lisp" {
+		t.Errorf("first server is %v", free)
+	}
+
+	if paid["server"] != "paid.example.org" || paid["groups"] != "alt.test" || paid["from"] != config["from"] {
+		t.Errorf("second server is %v", paid)
+	}
+
+	if Server(config, "")["section"] != "free" {
+		t.Errorf("default server is %v", Server(config, ""))
+	}
+}
+
+func TestFetchFromSeveralServers(t *testing.T) {
+	defer inTempDir(t)()
+
+	first := newTestServer(t, 3)
+	defer first.Close()
+
+	// has the second article of first, and one of its own
+	second := newTestServer(t, 0)
+	defer second.Close()
+	second.AddArticle("test.group", 7, "Message-ID: <2@test>\nSubject: article 2\n\nbody of 2")
+	second.AddArticle("test.group", 8, "Message-ID: <only@second>\nSubject: only here\n\nbody")
+
+	config := map[string]string{"sections": "first, second", "groups": "test.group"}
+	for name, server := range map[string]map[string]string{"first": first.Config(), "second": second.Config()} {
+		for key, value := range server {
+			config[name+"/"+key] = value
+		}
+	}
+
+	err := FetchArticles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _, err := GetArticles(testStore, "test.group")
+	if err != nil || len(raw) != 4 {
+		t.Errorf("expected 4 articles, got %d (%v)", len(raw), err)
+	}
+
+	if !testStore.Has("test.group", ArticleName(8, "second")) || testStore.Has("test.group", ArticleName(7, "second")) {
+		t.Errorf("duplicate saved or unique article missing")
+	}
+
+	for name, hi := range map[string]int{"first": 3, "second": 8} {
+		if w := testStore.Watermark("test.group", name); w != hi {
+			t.Errorf("watermark for %s is %d instead of %d", name, w, hi)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package nntp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Fills in „login“ and „pass“ of every server (see Servers) that
+// doesn't have them in the configuration file. They are taken
+// from the first of
+//
+//   - the environment variables named by „login-env“ and „pass-env“
+//   - the output of „pass-command“ (its first line), e. g. a
+//     password manager
+//   - the netrc file („netrc“, default ~/.netrc), from the entry
+//     for the server (and login, if known) or its default entry
+func resolveCredentials(config map[string]string) error {
+	if config["sections"] == "" {
+		return resolveServerCredentials(config, "")
+	}
+
+	for _, name := range strings.Split(config["sections"], ", ") {
+		err := resolveServerCredentials(config, name+"/")
+		if err != nil {
+			return fmt.Errorf("[%s] %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// See resolveCredentials; the keys of this server start with
+// prefix.
+func resolveServerCredentials(config map[string]string, prefix string) error {
+	server := Server(config, strings.TrimSuffix(prefix, "/"))
+	login, pass := server["login"], server["pass"]
+
+	if login == "" && server["login-env"] != "" {
+		login = os.Getenv(server["login-env"])
+	}
+
+	if pass == "" && server["pass-env"] != "" {
+		pass = os.Getenv(server["pass-env"])
+	}
+
+	if pass == "" && server["pass-command"] != "" {
+		output, err := exec.Command("sh", "-c", server["pass-command"]).Output()
+		if err != nil {
+			return fmt.Errorf("couldn't run pass-command (%w)", err)
+		}
+
+		pass, _ = firstAndRest(string(output), "\n")
+		pass = strings.TrimRight(pass, "\r")
+	}
+
+	if login == "" || pass == "" {
+		filename := server["netrc"]
+		if filename == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil
+			}
+
+			filename = filepath.Join(home, ".netrc")
+		}
+
+		data, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if entry, ok := findNetrc(parseNetrc(string(data)), server["server"], login); ok {
+			if login == "" {
+				login = entry.login
+			}
+
+			if pass == "" {
+				pass = entry.password
+			}
+		}
+	}
+
+	if login != "" {
+		config[prefix+"login"] = login
+	}
+
+	if pass != "" {
+		config[prefix+"pass"] = pass
+	}
+
+	return nil
+}
+
+// an entry of a netrc file; machine is "" for „default“
+type netrcEntry struct {
+	machine, login, password string
+}
+
+// Parses the tokens of a netrc file (see ftp(1)). Macro
+// definitions are skipped.
+func parseNetrc(data string) []netrcEntry {
+	rv := make([]netrcEntry, 0)
+	var current *netrcEntry
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		tokens := strings.Fields(lines[i])
+		for j := 0; j < len(tokens); j++ {
+			// value of a keyword
+			next := ""
+			if j+1 < len(tokens) {
+				next = tokens[j+1]
+			}
+
+			switch tokens[j] {
+			case "machine":
+				rv = append(rv, netrcEntry{machine: next})
+				current = &rv[len(rv)-1]
+				j++
+
+			case "default":
+				rv = append(rv, netrcEntry{})
+				current = &rv[len(rv)-1]
+
+			case "login", "password", "account":
+				if current != nil && tokens[j] == "login" {
+					current.login = next
+				} else if current != nil && tokens[j] == "password" {
+					current.password = next
+				}
+				j++
+
+			case "macdef":
+				// the macro ends with an empty line
+				for i+1 < len(lines) && TrimWhite(lines[i+1]) != "" {
+					i++
+				}
+				j = len(tokens)
+			}
+		}
+	}
+
+	return rv
+}
+
+// The entry for machine (and login, if not empty); the default
+// entry, if there's none.
+func findNetrc(entries []netrcEntry, machine, login string) (netrcEntry, bool) {
+	for _, entry := range entries {
+		if entry.machine == machine && (login == "" || entry.login == login) {
+			return entry, true
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.machine == "" && (login == "" || entry.login == login) {
+			return entry, true
+		}
+	}
+
+	return netrcEntry{}, false
+}
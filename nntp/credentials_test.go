@@ -0,0 +1,67 @@
+package nntp
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	entries := parseNetrc("machine news.example.org login jane password secret\n" +
+		"macdef init\ncd /pub\nmachine fake login x\n\n" +
+		"machine other.example.org\n  login joe\n  password other\n" +
+		"default login anonymous password jane@example.org\n")
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %v", entries)
+	}
+
+	if entry, ok := findNetrc(entries, "other.example.org", ""); !ok || entry.login != "joe" || entry.password != "other" {
+		t.Errorf("found %v for other.example.org", entry)
+	}
+
+	if entry, ok := findNetrc(entries, "unknown.example.org", ""); !ok || entry.login != "anonymous" {
+		t.Errorf("expected default entry for unknown.example.org, found %v", entry)
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	defer inTempDir(t)()
+
+	err := ioutil.WriteFile("netrc", []byte("machine news.example.org login jane password from-netrc\n"), PERM_MASK)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("LOREAD_TEST_PASS", "from-env")
+	defer os.Unsetenv("LOREAD_TEST_PASS")
+
+	err = ioutil.WriteFile("config.txt", []byte("netrc: netrc\n"+
+		"[netrc]\nserver: news.example.org\n"+
+		"[env]\nserver: news.example.org\nlogin: joe\npass-env: LOREAD_TEST_PASS\n"+
+		"[command]\nserver: news.example.org\nlogin: joe\npass-command: echo from-command; echo more\n"+
+		"[given]\nserver: news.example.org\nlogin: joe\npass: from-config\npass-env: LOREAD_TEST_PASS\n"), PERM_MASK)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig("config.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][2]string{
+		"netrc":   {"jane", "from-netrc"},
+		"env":     {"joe", "from-env"},
+		"command": {"joe", "from-command"},
+		"given":   {"joe", "from-config"},
+	}
+
+	for _, server := range Servers(config) {
+		want := expected[server["section"]]
+		if server["login"] != want[0] || server["pass"] != want[1] {
+			t.Errorf("%s: got %s/%s instead of %s/%s", server["section"],
+				server["login"], server["pass"], want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package nntp
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How long the articles of a group are kept (see Expire). Without
+// MaxAge and MaxCount, nothing is expired.
+type RetentionPolicy struct {
+	MaxAge      time.Duration // by Date header; 0 means no limit
+	MaxCount    int           // newest articles kept; 0 means no limit
+	KeepStarred bool          // starred articles are kept anyway
+	KeepUnread  bool          // unread articles are kept anyway
+}
+
+// The retention policy of group from the keys „expire-max-age“,
+// „expire-max-count“, „expire-keep-starred“ (default yes) and
+// „expire-keep-unread“ (default no). Every key may also be given
+// for the groups matching a wildmat, e. g. „expire-max-age
+// comp.lang.*: 90d“; the longest matching pattern wins.
+func GetRetentionPolicy(config map[string]string, group string) (RetentionPolicy, error) {
+	rv := RetentionPolicy{}
+
+	if age := expireKey(config, "expire-max-age", group); age != "" {
+		var err error
+		rv.MaxAge, err = ParseAge(age)
+		if err != nil {
+			return rv, fmt.Errorf("malformed expire-max-age %s for %s (%w)", age, group, err)
+		}
+	}
+
+	if count := expireKey(config, "expire-max-count", group); count != "" {
+		rv.MaxCount = atoi(count, -1)
+		if rv.MaxCount < 0 {
+			return rv, fmt.Errorf("malformed expire-max-count %s for %s", count, group)
+		}
+	}
+
+	rv.KeepStarred = expireKey(config, "expire-keep-starred", group) != "no"
+	rv.KeepUnread = expireKey(config, "expire-keep-unread", group) == "yes"
+	return rv, nil
+}
+
+// The value of key for group; see GetRetentionPolicy.
+func expireKey(config map[string]string, key, group string) string {
+	rv, longest := config[key], -1
+	for k, value := range config {
+		name, pattern := firstAndRest(k, " ")
+		if name == key && pattern != "" && len(pattern) > longest && MatchWildmat(pattern, group) {
+			rv, longest = value, len(pattern)
+		}
+	}
+
+	return rv
+}
+
+// What Expire did.
+type ExpireReport struct {
+	Articles int   // expired articles (including overview records)
+	Bytes    int64 // space reclaimed
+}
+
+// Removes the articles their group's retention policy (see
+// GetRetentionPolicy) doesn't keep from the store, together with
+// their overview data, and forgets the read marks and stars of
+// articles that are gone. The spool may well be a directory with
+// other things in it, so only subscribed groups and those in the
+// group list are looked at, and only files named like articles
+// (see ArticleName) are removed.
+func Expire(config map[string]string) (ExpireReport, error) {
+	var report ExpireReport
+
+	store := OpenStore(config)
+	groups, err := store.Groups()
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+
+	if err != nil {
+		return report, err
+	}
+
+	known, err := knownGroups(config, store)
+	if err != nil {
+		return report, err
+	}
+
+	for _, group := range groups {
+		if group == OUTBOX || !known[group] {
+			continue
+		}
+
+		policy, err := GetRetentionPolicy(config, group)
+		if err != nil {
+			return report, err
+		}
+
+		err = expireGroup(config, store, group, policy, &report)
+		if err != nil {
+			return report, fmt.Errorf("couldn't expire %s (%w)", group, err)
+		}
+	}
+
+	return report, nil
+}
+
+// The subscribed groups (see SubscribedGroups) and those in the
+// group list.
+func knownGroups(config map[string]string, store ArticleStore) (map[string]bool, error) {
+	subscribed, err := SubscribedGroups(config)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ReadGroupList(store)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]bool, len(subscribed)+len(list))
+	for _, group := range subscribed {
+		rv[group] = true
+	}
+
+	for _, group := range list {
+		rv[group.Name] = true
+	}
+
+	return rv, nil
+}
+
+// an article (or overview record) Expire might remove
+type expiryCandidate struct {
+	server string // see Servers
+	no     int
+	id     MessageId
+	date   time.Time
+	name   string // "" if we only have overview data
+	size   int
+}
+
+// See Expire; adds what was removed from group to report.
+func expireGroup(config map[string]string, store ArticleStore, group string, policy RetentionPolicy,
+	report *ExpireReport) error {
+	if policy.MaxAge == 0 && policy.MaxCount == 0 {
+		return nil
+	}
+
+	state, err := GetReadState(store, group)
+	if err != nil {
+		return err
+	}
+
+	starred, err := GetStarred(store, group)
+	if err != nil {
+		return err
+	}
+
+	names, err := store.List(group)
+	if err != nil {
+		return err
+	}
+
+	sections := make(map[string]bool)
+	for _, server := range Servers(config) {
+		sections[server["section"]] = true
+	}
+
+	candidates := make([]expiryCandidate, 0, len(names))
+	saved := make(map[string]bool, len(names))
+	for _, name := range names {
+		// not ours
+		no, server := splitArticleName(name)
+		if no < 0 || !sections[server] || ArticleName(no, server) != name {
+			continue
+		}
+
+		article, err := store.Get(group, name)
+		if err != nil {
+			return err
+		}
+
+		date := parseDate(articleHeader(string(article), "Date"))
+		candidates = append(candidates, expiryCandidate{server, no, articleId(string(article)), date, name, len(article)})
+		saved[name] = true
+	}
+
+	overviews := make(map[string][]OverviewRecord)
+	for _, server := range Servers(config) {
+		section := server["section"]
+		records, err := ReadOverview(store, group, section)
+		if err != nil {
+			return err
+		}
+
+		overviews[section] = records
+		for _, record := range records {
+			if !saved[ArticleName(record.Number, section)] {
+				date := parseDate(strings.TrimSpace(record.Date))
+				candidates = append(candidates, expiryCandidate{section, record.Number, record.Id, date, "", 0})
+			}
+		}
+	}
+
+	// newest first; we don't know how old articles without a
+	// (parseable) date are, so they stay
+	now := time.Now()
+	age := func(c expiryCandidate) time.Duration {
+		if c.date.IsZero() {
+			return 0
+		}
+
+		return now.Sub(c.date)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return age(candidates[i]) < age(candidates[j]) })
+
+	kept := 0
+	present := make(map[MessageId]bool)
+	expired := make(map[string]map[int]bool)
+	for _, c := range candidates {
+		protected := (policy.KeepStarred && starred[c.id]) ||
+			(policy.KeepUnread && !state.IsRead(c.server, c.no, c.id))
+		old := policy.MaxAge > 0 && age(c) > policy.MaxAge
+		tooMany := policy.MaxCount > 0 && kept >= policy.MaxCount
+
+		if protected || !(old || tooMany) {
+			kept++
+			present[c.id] = true
+			continue
+		}
+
+		if c.name != "" {
+			err = store.Delete(group, c.name)
+			if err != nil {
+				return err
+			}
+
+			report.Bytes += int64(c.size)
+		}
+
+		if expired[c.server] == nil {
+			expired[c.server] = make(map[int]bool)
+		}
+
+		expired[c.server][c.no] = true
+		report.Articles++
+	}
+
+	// overview data of expired articles
+	for server, records := range overviews {
+		if len(expired[server]) == 0 {
+			continue
+		}
+
+		rest := make([]OverviewRecord, 0, len(records))
+		for _, record := range records {
+			if expired[server][record.Number] {
+				report.Bytes += int64(len(record.String()) + 1)
+			} else {
+				rest = append(rest, record)
+			}
+		}
+
+		err = WriteOverview(store, group, server, rest)
+		if err != nil {
+			return err
+		}
+	}
+
+	// read marks (the numbers stay, as in .newsrc files) and stars
+	// of articles that are gone
+	stale := false
+	for id := range state.Ids {
+		if !present[id] {
+			delete(state.Ids, id)
+			stale = true
+		}
+	}
+
+	if stale {
+		err = SetReadState(store, group, state)
+		if err != nil {
+			return err
+		}
+	}
+
+	stale = false
+	for id := range starred {
+		if !present[id] {
+			delete(starred, id)
+			stale = true
+		}
+	}
+
+	if stale {
+		return SetStarred(store, group, starred)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package nntp
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	config := map[string]string{
+		"expire-max-age":                 "30d",
+		"expire-max-age comp.*":          "60d",
+		"expire-max-age comp.lang.*":     "90d",
+		"expire-keep-unread comp.lang.*": "yes",
+	}
+
+	policy, err := GetRetentionPolicy(config, "comp.lang.go")
+	if err != nil || policy != (RetentionPolicy{90 * 24 * time.Hour, 0, true, true}) {
+		t.Errorf("policy for comp.lang.go is %+v (%v)", policy, err)
+	}
+
+	if policy, _ := GetRetentionPolicy(config, "rec.games.go"); policy.MaxAge != 30*24*time.Hour || policy.KeepUnread {
+		t.Errorf("policy for rec.games.go is %+v", policy)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	defer inTempDir(t)()
+
+	// article no is no days old
+	for no := 1; no <= 6; no++ {
+		date := time.Now().Add(-time.Duration(no) * 24 * time.Hour)
+		testStore.Put("test.group", strconv.Itoa(no), RawArticle(fmt.Sprintf(
+			"Date: %s\nMessage-ID: <%d@test>\n\nbody", date.Format(time.RFC1123Z), no)))
+	}
+
+	WriteOverview(testStore, "test.group", "", []OverviewRecord{
+		{Number: 7, Date: time.Now().Add(-7 * 24 * time.Hour).Format(time.RFC1123Z), Id: "<7@test>"},
+	})
+
+	SetStarred(testStore, "test.group", map[MessageId]bool{"<5@test>": true, "<gone@test>": true})
+	SetReadState(testStore, "test.group", ReadState{
+		Numbers: map[string]Ranges{"": ParseRanges("1-5")},
+		Ids:     map[MessageId]bool{"<gone@test>": true},
+	})
+
+	config := map[string]string{"groups": "test.group", "expire-max-age": "84h", "expire-max-count": "2"}
+	report, err := Expire(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3 is too many, 5 is starred, 4, 6 and 7 are too old
+	for no, kept := range map[int]bool{1: true, 2: true, 3: false, 4: false, 5: true, 6: false} {
+		if testStore.Has("test.group", strconv.Itoa(no)) != kept {
+			t.Errorf("article %d wrongly expired or kept", no)
+		}
+	}
+
+	if records, _ := ReadOverview(testStore, "test.group", ""); len(records) != 0 {
+		t.Errorf("overview data not expired: %+v", records)
+	}
+
+	if report.Articles != 4 || report.Bytes <= 0 {
+		t.Errorf("wrong report %+v", report)
+	}
+
+	starred, _ := GetStarred(testStore, "test.group")
+	state, _ := GetReadState(testStore, "test.group")
+	if starred["<gone@test>"] || !starred["<5@test>"] || state.Ids["<gone@test>"] {
+		t.Errorf("stale stars %v or read marks %v not removed", starred, state.Ids)
+	}
+
+	// unread articles may be kept
+	testStore.Put("test.group", "9", RawArticle("Date: "+
+		time.Now().Add(-48*time.Hour).Format(time.RFC1123Z)+"\nMessage-ID: <9@test>\n\nbody"))
+	config["expire-keep-unread"] = "yes"
+	config["expire-max-count"] = "0"
+	config["expire-max-age"] = "1h"
+	if _, err = Expire(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if testStore.Has("test.group", "1") || !testStore.Has("test.group", "9") {
+		t.Errorf("expire-keep-unread ignored")
+	}
+}
+
+// Directories and files in the spool that aren't ours stay.
+func TestExpireForeign(t *testing.T) {
+	defer inTempDir(t)()
+
+	old := "Date: " + time.Now().Add(-48*time.Hour).Format(time.RFC1123Z) + "\n\nbody"
+	for _, name := range []string{"1", "notes.txt", "2.go", "03"} {
+		testStore.Put("test.group", name, RawArticle(old))
+		testStore.Put("nntp", name, RawArticle(old))
+	}
+
+	if _, err := Expire(map[string]string{"groups": "test.group", "expire-max-count": "0", "expire-max-age": "1h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"1", "notes.txt", "2.go", "03"} {
+		if !testStore.Has("nntp", name) {
+			t.Errorf("%s removed from a foreign directory", name)
+		}
+
+		if testStore.Has("test.group", name) != (name != "1") {
+			t.Errorf("%s wrongly expired or kept", name)
+		}
+	}
+}
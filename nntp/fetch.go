@@ -0,0 +1,529 @@
+package nntp
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Values for the „fetch-mode“ key in the configuration.
+const (
+	FETCH_FULL     = "full"     // fetch whole articles (default)
+	FETCH_OVERVIEW = "overview" // fetch overview data; bodies later
+)
+
+// Values for the „fetch-bodies“ key in the configuration. This
+// only matters for FETCH_OVERVIEW.
+const (
+	BODIES_ON_DEMAND  = "on-demand"  // when reading the article (default)
+	BODIES_BACKGROUND = "background" // see FetchBodies
+)
+
+// Fetches articles as specified in the configuration (from every
+// server, see Servers). Before that, articles written in the
+// meantime are posted.
+func FetchArticles(config map[string]string) error {
+	err := FlushOutbox(config)
+	if err != nil {
+		// refused articles stay in the outbox; let's fetch anyway
+		log.Printf("couldn't post everything from the outbox: %s", err)
+	}
+
+	// the whole list is only fetched on request (it's big)
+	store := OpenStore(config)
+	if groupList, _ := ReadGroupList(store); len(groupList) > 0 {
+		err = RefreshGroupList(config, false)
+		if err != nil {
+			log.Printf("couldn't update the group list: %s", err)
+		}
+	}
+
+	// one server failing shouldn't keep us from the others
+	var firstErr error
+	for _, server := range Servers(config) {
+		err = fetchServer(server, store)
+		if err != nil && len(Servers(config)) > 1 {
+			log.Printf("couldn't fetch from %s: %s", server["section"], err)
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Fetches the subscribed groups from the server configured in
+// config into store.
+func fetchServer(config map[string]string, store ArticleStore) error {
+	patterns, err := ReadSubscriptions(config)
+	if err != nil {
+		return err
+	}
+
+	if len(patterns) == 0 {
+		return fmt.Errorf("no groups given")
+	}
+
+	// new groups may match
+	groups, err := expandSubscriptions(config, patterns)
+	if err != nil {
+		return fmt.Errorf("couldn't expand %s (%w)", strings.Join(patterns, ","), err)
+	}
+
+	if len(groups) == 0 {
+		return fmt.Errorf("no groups match %s", strings.Join(patterns, ","))
+	}
+
+	return fetchParallel(config, store, groups)
+}
+
+// Downloads the articles of all subscribed groups for which we
+// only have overview data (see FETCH_OVERVIEW).
+func FetchBodies(config map[string]string) error {
+	store := OpenStore(config)
+	for _, server := range Servers(config) {
+		err := fetchBodies(server, store)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// See FetchBodies; for a single server.
+func fetchBodies(config map[string]string, store ArticleStore) error {
+	client, err := connect(config)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	groups, err := SubscribedGroups(config)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		records, err := ReadOverview(store, g, config["section"])
+		if err != nil {
+			return err
+		}
+
+		missing := make([]int, 0)
+		for _, record := range records {
+			if !store.Has(g, ArticleName(record.Number, config["section"])) {
+				missing = append(missing, record.Number)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		_, _, _, err = client.Group(g)
+		if err != nil {
+			return fmt.Errorf("couldn't choose group %s (%w)", g, err)
+		}
+
+		err = fetchPipelined(client, store, g, missing, config, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	client.Quit()
+	return nil
+}
+
+// Fetches a single article (e. g. one we only know from its
+// overview data) on its own connection to the server configured
+// in config and saves it in store.
+func FetchArticle(config map[string]string, store ArticleStore, group string, no int) (RawArticle, error) {
+	client, err := connect(config)
+	if err != nil {
+		return "", err
+	}
+
+	defer client.Close()
+
+	_, _, _, err = client.Group(group)
+	if err != nil {
+		return "", err
+	}
+
+	article, err := fetchArticle(client, store, group, no, config["section"])
+	if err != nil {
+		return "", err
+	}
+
+	client.Quit()
+	return article, nil
+}
+
+// Connects to the server and authenticates, if a login is given
+// and the server offers authentication (see Client.Login and
+// the key „auth-mechanisms“); otherwise, we stay anonymous. With
+// several servers, the first one is used unless config is one of
+// Servers.
+func connect(config map[string]string) (*Client, error) {
+	config = Server(config, "")
+	username, passw := config["login"], config["pass"]
+
+	// connect and say hello (encrypted, if requested)
+	client, err := Dial(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to server (%w)", err)
+	}
+
+	if username != "" && client.CanAuthenticate() {
+		mechanisms := DEFAULT_MECHANISMS
+		if config["auth-mechanisms"] != "" {
+			mechanisms = strings.Split(config["auth-mechanisms"], ", ")
+		}
+
+		err = client.Login(username, passw, mechanisms)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("couldn't authenticate (%w)", err)
+		}
+	}
+
+	// if the server refuses, we simply go on uncompressed
+	if config["compress"] != "no" && client.CanCompress() {
+		err = client.Compress()
+		if _, refused := err.(*Error); err != nil && !refused {
+			client.Close()
+			return nil, fmt.Errorf("couldn't start compression (%w)", err)
+		}
+	}
+
+	return client, nil
+}
+
+// Selects group and finds out which of its articles are new. In
+// FETCH_OVERVIEW mode, their overview data is fetched right away
+// and the result is nil; otherwise, articles that failed last time
+// are fetched again and the new ones are left to the result (see
+// groupFetch).
+func beginGroup(client *Client, store ArticleStore, group string, config map[string]string) (*groupFetch, error) {
+	fetchMaximum := atoi(config["fetch-maximum"], 100) // reasonable (?) default
+
+	// select group; get server's watermark
+	_, lo, hi, err := client.Group(group)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't choose group %s (%w)", group, err)
+	}
+
+	server := config["section"]
+	watermark := store.Watermark(group, server)
+
+	// the first time, fetch-since may allow fewer articles
+	if watermark == 0 && config["fetch-since"] != "" {
+		fetchMaximum, err = limitSince(client, group, config["fetch-since"], lo, hi, fetchMaximum)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// we can't catch up with server anymore because we are
+	// too far behind; continue with its first article, lo
+	if watermark < lo-1 {
+		watermark = lo - 1
+	}
+
+	if config["fetch-mode"] == FETCH_OVERVIEW {
+		return nil, fetchOverview(client, store, group, server, watermark, hi, fetchMaximum)
+	}
+
+	// retry articles that failed last time
+	err = retryGaps(client, store, group, lo, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// get a list of article numbers
+	articles, err := client.ListGroup(group, watermark+1)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list group %s (%w)", group, err)
+	}
+
+	// get only the last fetchMaximum articles
+	if len(articles) > fetchMaximum {
+		articles = articles[len(articles)-fetchMaximum:]
+	}
+
+	fetch := &groupFetch{
+		store:     store,
+		group:     group,
+		server:    server,
+		hi:        hi,
+		watermark: watermark,
+		gaps:      GetGaps(store, group, server),
+	}
+
+	if len(articles) > 0 {
+		fetch.parts, fetch.done = [][]int{articles}, []int{0}
+	}
+
+	return fetch, nil
+}
+
+// The new articles of a group, maybe split into parts that are
+// fetched on different connections (see fetchParallel). The
+// watermark follows the saved articles, so an interrupted fetch
+// continues where it stopped; it only advances up to the first
+// part that isn't finished, so nothing below it is missing.
+type groupFetch struct {
+	store         ArticleStore
+	group, server string
+	hi            int // the server's high watermark
+
+	mu        sync.Mutex
+	watermark int     // as saved
+	parts     [][]int // article numbers, ascending; not empty
+	done      []int   // how many of every part have been fetched
+	gaps      Ranges  // see GetGaps
+}
+
+// Splits the articles into up to n parts of at least
+// MIN_PART_SIZE articles (but at least one part, unless there's
+// nothing to fetch).
+func (g *groupFetch) split(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	articles := make([]int, 0)
+	for i, part := range g.parts {
+		articles = append(articles, part[g.done[i]:]...)
+	}
+
+	if n > len(articles)/MIN_PART_SIZE {
+		n = len(articles) / MIN_PART_SIZE
+	}
+
+	if n < 1 {
+		n = 1
+	}
+
+	g.parts, g.done = make([][]int, 0, n), make([]int, 0, n)
+	for i := 0; i < n && len(articles) > 0; i++ {
+		g.parts = append(g.parts, articles[i*len(articles)/n:(i+1)*len(articles)/n])
+		g.done = append(g.done, 0)
+	}
+}
+
+// Fetches what's left of part on client (selecting the group).
+func (g *groupFetch) fetch(client *Client, config map[string]string, part int) error {
+	_, _, _, err := client.Group(g.group)
+	if err != nil {
+		return fmt.Errorf("couldn't choose group %s (%w)", g.group, err)
+	}
+
+	g.mu.Lock()
+	numbers := g.parts[part][g.done[part]:]
+	g.mu.Unlock()
+
+	return fetchPipelined(client, g.store, g.group, numbers, config, func(no int, ok bool) error {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if !ok {
+			g.gaps.Add(no)
+			err := SetGaps(g.store, g.group, g.server, g.gaps)
+			if err != nil {
+				return err
+			}
+		}
+
+		g.done[part]++
+		return g.saveLocked()
+	})
+}
+
+// Saves the watermark if it has advanced.
+func (g *groupFetch) save() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.saveLocked()
+}
+
+// See save; must be called with g.mu held.
+func (g *groupFetch) saveLocked() error {
+	// everything up to hi is done (the numbers without articles
+	// don't exist), unless a part isn't finished
+	watermark := g.hi
+	if n := len(g.parts); n > 0 && g.parts[n-1][len(g.parts[n-1])-1] > watermark {
+		watermark = g.parts[n-1][len(g.parts[n-1])-1]
+	}
+
+	for i, part := range g.parts {
+		if g.done[i] < len(part) {
+			// the last article before the unfinished one
+			watermark = g.watermark
+			if g.done[i] > 0 {
+				watermark = part[g.done[i]-1]
+			} else if i > 0 {
+				watermark = g.parts[i-1][len(g.parts[i-1])-1]
+			}
+
+			break
+		}
+	}
+
+	if watermark <= g.watermark {
+		return nil
+	}
+
+	g.watermark = watermark
+	return g.store.SetWatermark(g.group, g.server, watermark)
+}
+
+// Tries again to fetch the articles from group that failed
+// before (see GetGaps). Those below lo have expired.
+func retryGaps(client *Client, store ArticleStore, group string, lo int, config map[string]string) error {
+	server := config["section"]
+	gaps := GetGaps(store, group, server)
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	gaps.RemoveBelow(lo)
+	err := fetchPipelined(client, store, group, gaps.Numbers(), config, func(no int, ok bool) error {
+		if ok {
+			gaps.Remove(no)
+		}
+
+		return nil
+	})
+
+	// save progress in any case
+	err2 := SetGaps(store, group, server, gaps)
+	if err != nil {
+		return err
+	}
+
+	return err2
+}
+
+// Fetches the overview data of the (at most fetchMaximum)
+// articles after watermark and saves it; see FETCH_OVERVIEW.
+func fetchOverview(client *Client, store ArticleStore, group, server string, watermark, hi, fetchMaximum int) error {
+	from := watermark + 1
+	if hi-fetchMaximum+1 > from {
+		from = hi - fetchMaximum + 1
+	}
+
+	if from <= hi {
+		records, err := client.Overview(from, hi)
+		if err != nil {
+			return fmt.Errorf("couldn't get overview of %s (%w)", group, err)
+		}
+
+		err = AppendOverview(store, group, server, records)
+		if err != nil {
+			return err
+		}
+	}
+
+	if watermark > hi {
+		hi = watermark
+	}
+
+	return store.SetWatermark(group, server, hi)
+}
+
+// Fetches the articles numbers from group (which must be
+// selected) and saves them in store, using a pipeline of „pipeline-window“ commands.
+// Articles the server doesn't have (any more) are skipped. After
+// each article, checkpoint is called (if not nil) with ok set
+// unless the server failed to send it for some other reason. With
+// several servers, articles we already have from another one
+// (with the same Message-ID) aren't saved again.
+func fetchPipelined(client *Client, store ArticleStore, group string, numbers []int, config map[string]string,
+	checkpoint func(no int, ok bool) error) error {
+	window := atoi(config["pipeline-window"], 16)
+	server := config["section"]
+
+	specs := make([]string, len(numbers))
+	for i, no := range numbers {
+		specs[i] = strconv.Itoa(no)
+	}
+
+	return client.Pipeline("ARTICLE", specs, window, func(spec, text string, err error) error {
+		ok := true
+
+		if IsNoSuchArticle(err) {
+			// e. g. expired or cancelled in the meantime
+		} else if _, refused := err.(*Error); refused {
+			ok = false
+		} else if err != nil {
+			return err
+		} else if saved, err := savedName(store, group, articleId(text)); err != nil {
+			return err
+		} else if server == "" || saved == "" {
+			err = store.Put(group, ArticleName(atoi(spec, 0), server), RawArticle(text))
+			if err != nil {
+				return err
+			}
+		}
+
+		if checkpoint == nil {
+			return nil
+		}
+
+		return checkpoint(atoi(spec, 0), ok)
+	})
+}
+
+func fetchArticle(client *Client, store ArticleStore, group string, no int, server string) (RawArticle, error) {
+	article, err := client.Article(strconv.Itoa(no))
+	if err != nil {
+		return "", err
+	}
+
+	return article, store.Put(group, ArticleName(no, server), article)
+}
+
+// The name (see ArticleName) under which the article with
+// Message-ID id is saved in group, or "" (see ArticleStore.Lookup).
+func savedName(store ArticleStore, group string, id MessageId) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+
+	entries, err := store.Lookup(id)
+	for _, entry := range entries {
+		if entry.Group == group {
+			return entry.Name, err
+		}
+	}
+
+	return "", err
+}
+
+// The Message-ID header of article (without parsing all of it).
+func articleId(article string) MessageId {
+	return MessageId(articleHeader(article, "Message-ID"))
+}
+
+// The header key of article (without parsing all of it), or "".
+func articleHeader(article, key string) string {
+	for _, line := range strings.Split(article, "\n") {
+		if line == "" {
+			break
+		}
+
+		if name, value := firstAndRest(line, ":"); strings.EqualFold(name, key) {
+			return TrimWhite(value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,335 @@
+package nntp
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kedorlaomer/loread/nntp/nntptest"
+)
+
+// Fetches from a test server and looks at the result in the
+// local HTTP server.
+func TestFetchAndServe(t *testing.T) {
+	for _, mode := range []string{FETCH_FULL, FETCH_OVERVIEW} {
+		func() {
+			defer inTempDir(t)()
+
+			server := newTestServer(t, 3)
+			defer server.Close()
+
+			config := server.Config()
+			config["groups"] = "test.group"
+			config["fetch-mode"] = mode
+
+			err := FetchArticles(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := newState(config)
+
+			page := get(s, url.Values{"view": {"group"}, "arg": {"test.group"}})
+			for _, subject := range []string{"article 1", "article 2", "article 3"} {
+				if !strings.Contains(page, subject) {
+					t.Errorf("%s: group overview doesn't list %q", mode, subject)
+				}
+			}
+
+			// in overview mode, this is fetched on demand
+			page = get(s, url.Values{"view": {"article"}, "arg": {"<3@test>"}})
+			if !strings.Contains(page, "body of 3") {
+				t.Errorf("%s: article page doesn't show body: %s", mode, page)
+			}
+
+			if !testStore.Has("test.group", "3") {
+				t.Errorf("%s: article 3 wasn't saved", mode)
+			}
+
+			if w := testStore.Watermark("test.group", ""); w != 3 {
+				t.Errorf("%s: watermark is %d instead of 3", mode, w)
+			}
+		}()
+	}
+}
+
+// Requests are served concurrently (e. g. several tabs), all of
+// them using the current group and its pending articles.
+func TestConcurrentRequests(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 10)
+	defer server.Close()
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	config["fetch-mode"] = FETCH_OVERVIEW
+	if err := FetchArticles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// articles known only from the overview are found through the
+	// group
+	s := newState(config)
+	get(s, url.Values{"view": {"group"}, "arg": {"test.group"}})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			get(s, url.Values{"view": {"group"}, "arg": {"test.group"}})
+		}()
+
+		go func(no int) {
+			defer wg.Done()
+			get(s, url.Values{"view": {"article"}, "arg": {fmt.Sprintf("<%d@test>", no)}})
+		}(i)
+	}
+
+	wg.Wait()
+	for i := 1; i <= 10; i++ {
+		if !testStore.Has("test.group", strconv.Itoa(i)) {
+			t.Errorf("article %d wasn't saved", i)
+		}
+	}
+}
+
+func TestConnectionLimit(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+	server.AddArticle("other.group", 1, "Message-ID: <other@test>\n\nbody")
+
+	// only one connection allowed
+	server.SetFault(func(connection int, line string) (string, bool) {
+		if connection > 1 && line == "" {
+			return "400 too many connections", false
+		}
+		return "", false
+	})
+
+	config := server.Config()
+	config["groups"] = "test.group, other.group"
+	config["max-connections"] = "4"
+
+	err := FetchArticles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !testStore.Has("test.group", "3") || !testStore.Has("other.group", "1") {
+		t.Errorf("not all groups were fetched")
+	}
+}
+
+func TestPostFromUI(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 1)
+	defer server.Close()
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	s := newState(config)
+
+	form := url.Values{
+		"from":       {"me <me@example.org>"},
+		"newsgroups": {"test.group"},
+		"subject":    {"hello"},
+		"body":       {"text"},
+		"action":     {"Send"},
+	}
+
+	if page := post(s, "post", "http://example.com", form); !strings.Contains(page, "has been posted") {
+		t.Errorf("posting failed: %s", page)
+	}
+
+	posted := server.Posted()
+	if len(posted) != 1 || !strings.Contains(posted[0], "Subject: hello") ||
+		!strings.Contains(posted[0], "Message-ID: <") {
+		t.Errorf("server got %q", posted)
+	}
+
+	if entries, _ := ReadOutbox(testStore); len(entries) != 0 {
+		t.Errorf("posted article is still in the outbox")
+	}
+
+	// refused articles stay in the outbox
+	server.SetFault(func(connection int, line string) (string, bool) {
+		if line == "POST" {
+			return "440 posting not permitted", false
+		}
+		return "", false
+	})
+
+	post(s, "post", "http://example.com", form)
+
+	entries, _ := ReadOutbox(testStore)
+	if len(entries) != 1 || !strings.Contains(entries[0].Error, "440") {
+		t.Errorf("refused article not kept with error: %+v", entries)
+	}
+}
+
+// Serves the query values and returns the page.
+func get(s *state, values url.Values) string {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest("GET", "/?"+values.Encode(), nil))
+	return recorder.Body.String()
+}
+
+// Like get, but posts values as a form from origin (e. g. one of
+// our own pages, "http://example.com/").
+func post(s *state, view, origin string, values url.Values) string {
+	request := httptest.NewRequest("POST", "/?view="+view, strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Origin", origin)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+	return recorder.Body.String()
+}
+
+// Without a watermark, fetching starts with the server's first
+// article (not the one after it).
+func TestLowWatermark(t *testing.T) {
+	for _, mode := range []string{FETCH_FULL, FETCH_OVERVIEW} {
+		func() {
+			defer inTempDir(t)()
+
+			server, err := nntptest.NewServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+
+			for no := 5; no <= 7; no++ {
+				server.AddArticle("test.group", no, fmt.Sprintf("Subject: article %d\nMessage-ID: <%d@test>\n\nbody", no, no))
+			}
+
+			config := server.Config()
+			config["groups"] = "test.group"
+			config["fetch-mode"] = mode
+			if err := FetchArticles(config); err != nil {
+				t.Fatal(err)
+			}
+
+			records, _ := ReadOverview(testStore, "test.group", "")
+			if mode == FETCH_FULL && !testStore.Has("test.group", "5") ||
+				mode == FETCH_OVERVIEW && (len(records) != 3 || records[0].Number != 5) {
+				t.Errorf("%s: article 5 not fetched (overview %+v)", mode, records)
+			}
+
+			if testStore.Watermark("test.group", "") != 7 {
+				t.Errorf("%s: wrong watermark %d", mode, testStore.Watermark("test.group", ""))
+			}
+		}()
+	}
+}
+
+// A large group is fetched on several connections.
+func TestSplitGroup(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 4*MIN_PART_SIZE)
+	defer server.Close()
+
+	var mu sync.Mutex
+	used := make(map[int]bool)
+	server.SetFault(func(connection int, line string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if strings.HasPrefix(line, "ARTICLE") {
+			used[connection] = true
+		}
+		return "", false
+	})
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	config["fetch-maximum"] = "1000"
+	config["max-connections"] = "3"
+	if err := FetchArticles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, _ := testStore.List("test.group"); len(names) != 4*MIN_PART_SIZE {
+		t.Errorf("%d articles fetched", len(names))
+	}
+
+	if w := testStore.Watermark("test.group", ""); w != 4*MIN_PART_SIZE {
+		t.Errorf("watermark is %d", w)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(used) != 3 {
+		t.Errorf("articles fetched on %d connections", len(used))
+	}
+}
+
+// The watermark doesn't skip parts that aren't finished.
+func TestSplitWatermark(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 2*MIN_PART_SIZE)
+	defer server.Close()
+
+	// the first part fails in the middle
+	server.SetFault(func(connection int, line string) (string, bool) {
+		return "", line == "ARTICLE 10"
+	})
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	config["fetch-maximum"] = "1000"
+	config["max-connections"] = "2"
+	config["retry-limit"] = "0"
+	if err := FetchArticles(config); err == nil {
+		t.Fatal("no error")
+	}
+
+	// (pipelined articles before 10 may be lost, too)
+	if w := testStore.Watermark("test.group", ""); w >= 10 {
+		t.Errorf("watermark %d skips article 10", w)
+	}
+
+	if !testStore.Has("test.group", strconv.Itoa(2*MIN_PART_SIZE)) {
+		t.Errorf("second part not fetched")
+	}
+
+	// the next fetch completes it
+	server.SetFault(nil)
+	if err := FetchArticles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := testStore.Watermark("test.group", ""); w != 2*MIN_PART_SIZE || !testStore.Has("test.group", "10") {
+		t.Errorf("not completed; watermark is %d", w)
+	}
+}
+
+// A group the server doesn't have doesn't keep us from the
+// others.
+func TestMissingGroup(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+
+	config := server.Config()
+	config["groups"] = "aaa.gone, test.group"
+	if err := FetchArticles(config); err == nil || !strings.Contains(err.Error(), "411") {
+		t.Errorf("missing group gives %v", err)
+	}
+
+	if !testStore.Has("test.group", "3") {
+		t.Errorf("test.group not fetched")
+	}
+}
@@ -0,0 +1,351 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NNTP protocol codes for group lists
+const (
+	LIST_FOLLOWS      = 215
+	NEWGROUPS_FOLLOWS = 231
+)
+
+// files in which we keep the server's group list, the time of its
+// last update and the subscribed groups
+const (
+	GROUP_LIST         = ".grouplist"
+	GROUP_LIST_UPDATED = ".grouplist-date"
+	SUBSCRIPTIONS      = "subscriptions"
+)
+
+// A group as listed by LIST ACTIVE (see RFC 3977, 7.6.3), with its
+// description from LIST NEWSGROUPS.
+type ActiveGroup struct {
+	Name        string
+	Hi, Lo      int    // high and low watermark
+	Status      string // „y“ (posting allowed), „n“ (not allowed), „m“ (moderated) etc.
+	Description string
+}
+
+// Lists the groups known to the server (matching wildmat, if not
+// empty).
+func (c *Client) ListActive(wildmat string) ([]ActiveGroup, error) {
+	command := "LIST ACTIVE"
+	if wildmat != "" {
+		command += " " + wildmat
+	}
+
+	lines, err := c.list(LIST_FOLLOWS, "%s", command)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseActive(lines), nil
+}
+
+// Lists the groups created since the given time.
+func (c *Client) NewGroups(since time.Time) ([]ActiveGroup, error) {
+	lines, err := c.list(NEWGROUPS_FOLLOWS, "NEWGROUPS %s GMT",
+		since.UTC().Format("20060102 150405"))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseActive(lines), nil
+}
+
+// Maps group names (matching wildmat, if not empty) to their
+// descriptions.
+func (c *Client) ListNewsgroups(wildmat string) (map[string]string, error) {
+	command := "LIST NEWSGROUPS"
+	if wildmat != "" {
+		command += " " + wildmat
+	}
+
+	lines, err := c.list(LIST_FOLLOWS, "%s", command)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]string)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			rv[fields[0]] = strings.Join(fields[1:], " ")
+		}
+	}
+
+	return rv, nil
+}
+
+// Like multiline, but returns the lines.
+func (c *Client) list(expected int, format string, args ...interface{}) ([]string, error) {
+	_, _, err := c.cmd(expected, format, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.conn.ReadDotLines()
+}
+
+// lines look like „comp.lang.lisp 0000123456 0000100000 y“
+func parseActive(lines []string) []ActiveGroup {
+	rv := make([]ActiveGroup, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+
+		rv = append(rv, ActiveGroup{
+			Name:   fields[0],
+			Hi:     atoi(fields[1], 0),
+			Lo:     atoi(fields[2], 0),
+			Status: fields[3],
+		})
+	}
+
+	return rv
+}
+
+// Updates our copy of the server's group list. The first time
+// (or if full is set), the whole list is fetched; afterwards,
+// only the groups created since the last update are added.
+func UpdateGroupList(client *Client, store ArticleStore, full bool) error {
+	now := time.Now()
+	groups, err := ReadGroupList(store)
+	if err != nil {
+		return err
+	}
+
+	updated, err := groupListUpdated(store)
+	if err != nil || len(groups) == 0 {
+		full = true
+	}
+
+	var descriptions map[string]string
+	if full {
+		groups, err = client.ListActive("")
+		if err != nil {
+			return err
+		}
+
+		descriptions, err = client.ListNewsgroups("")
+	} else {
+		var added []ActiveGroup
+		added, err = client.NewGroups(updated)
+		if err != nil || len(added) == 0 {
+			return err
+		}
+
+		// only ask for the new groups' descriptions
+		names := make([]string, len(added))
+		for i, group := range added {
+			names[i] = group.Name
+		}
+
+		groups = append(groups, added...)
+		descriptions, err = client.ListNewsgroups(strings.Join(names, ","))
+	}
+
+	// descriptions are nice, but not necessary
+	if err == nil {
+		for i := range groups {
+			if d, ok := descriptions[groups[i].Name]; ok {
+				groups[i].Description = d
+			}
+		}
+	}
+
+	err = writeGroupList(store, groups)
+	if err != nil {
+		return err
+	}
+
+	return store.WriteData("", GROUP_LIST_UPDATED, []byte(now.UTC().Format(time.RFC3339)))
+}
+
+// Like UpdateGroupList, but on its own connection.
+func RefreshGroupList(config map[string]string, full bool) error {
+	client, err := connect(config)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	err = UpdateGroupList(client, OpenStore(config), full)
+	if err != nil {
+		return err
+	}
+
+	client.Quit()
+	return nil
+}
+
+// Reads our copy of the server's group list, sorted by name.
+func ReadGroupList(store ArticleStore) ([]ActiveGroup, error) {
+	data, err := store.ReadData("", GROUP_LIST)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]ActiveGroup, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// name, hi, lo, status, description
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(fields) < 5 {
+			continue
+		}
+
+		rv = append(rv, ActiveGroup{
+			Name:        fields[0],
+			Hi:          atoi(fields[1], 0),
+			Lo:          atoi(fields[2], 0),
+			Status:      fields[3],
+			Description: fields[4],
+		})
+	}
+
+	return rv, scanner.Err()
+}
+
+// See ReadGroupList.
+func writeGroupList(store ArticleStore, groups []ActiveGroup) error {
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	lines := make([]string, 0, len(groups))
+	for i, group := range groups {
+		// NEWGROUPS might tell us about groups we already know
+		if i > 0 && groups[i-1].Name == group.Name {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%d\t%s\t%s",
+			group.Name, group.Hi, group.Lo, group.Status, group.Description))
+	}
+
+	return store.WriteData("", GROUP_LIST, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// When did we last update the group list?
+func groupListUpdated(store ArticleStore) (time.Time, error) {
+	data, err := store.ReadData("", GROUP_LIST_UPDATED)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, TrimWhite(string(data)))
+}
+
+// Groups from the group list whose name or description contains
+// search (ignoring case).
+func SearchGroupList(groups []ActiveGroup, search string) []ActiveGroup {
+	search = strings.ToLower(search)
+	rv := make([]ActiveGroup, 0)
+	for _, group := range groups {
+		if strings.Contains(strings.ToLower(group.Name), search) ||
+			strings.Contains(strings.ToLower(group.Description), search) {
+			rv = append(rv, group)
+		}
+	}
+
+	return rv
+}
+
+// Reads the subscribed groups from the file SUBSCRIPTIONS (one
+// per line). If there's no such file yet, the „groups“ from the
+// configuration are used. Entries may be wildmat patterns (see
+// MatchWildmat); SubscribedGroups expands them. Every server (see
+// Servers) has its own subscriptions; by default, the first one's.
+func ReadSubscriptions(config map[string]string) ([]string, error) {
+	config = Server(config, "")
+	data, err := OpenStore(config).ReadData("", serverFile(SUBSCRIPTIONS, config["section"]))
+	if os.IsNotExist(err) {
+		rv := make([]string, 0)
+		for _, group := range strings.Split(config["groups"], ",") {
+			if group = TrimWhite(group); group != "" {
+				rv = append(rv, group)
+			}
+		}
+
+		return rv, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = TrimWhite(line); line != "" {
+			rv = append(rv, line)
+		}
+	}
+
+	return rv, nil
+}
+
+// See ReadSubscriptions.
+func WriteSubscriptions(config map[string]string, groups []string) error {
+	filename := serverFile(SUBSCRIPTIONS, Server(config, "")["section"])
+	return OpenStore(config).WriteData("", filename, []byte(strings.Join(groups, "\n")+"\n"))
+}
+
+// Adds group to the subscribed groups (if it isn't there yet).
+func Subscribe(config map[string]string, group string) ([]string, error) {
+	patterns, err := withoutGroup(config, group)
+	if err != nil {
+		return nil, err
+	}
+
+	if !MatchWildmat(strings.Join(patterns, ","), group) {
+		patterns = append(patterns, group)
+	}
+
+	return patterns, WriteSubscriptions(config, patterns)
+}
+
+// Removes group from the subscribed groups; if a wildmat still
+// matches it, it is excluded explicitly. Its saved articles are
+// kept.
+func Unsubscribe(config map[string]string, group string) ([]string, error) {
+	patterns, err := withoutGroup(config, group)
+	if err != nil {
+		return nil, err
+	}
+
+	if MatchWildmat(strings.Join(patterns, ","), group) {
+		patterns = append(patterns, "!"+group)
+	}
+
+	return patterns, WriteSubscriptions(config, patterns)
+}
+
+// The subscriptions without entries for exactly group.
+func withoutGroup(config map[string]string, group string) ([]string, error) {
+	patterns, err := ReadSubscriptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern != group && pattern != "!"+group {
+			rv = append(rv, pattern)
+		}
+	}
+
+	return rv, nil
+}
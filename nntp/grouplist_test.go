@@ -0,0 +1,108 @@
+package nntp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupList(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+	server.AddGroup("test.other", "Other things", time.Now().Add(-time.Hour))
+
+	config := server.Config()
+	if err := RefreshGroupList(config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := ReadGroupList(testStore)
+	if err != nil || len(groups) != 2 || groups[0].Name != "test.group" || groups[0].Hi != 3 {
+		t.Fatalf("group list is %v (%v)", groups, err)
+	}
+
+	if groups[1].Description != "Other things" {
+		t.Errorf("description of %s is %q", groups[1].Name, groups[1].Description)
+	}
+
+	// only NEWGROUPS this time
+	server.AddGroup("test.new", "Brand new", time.Now().Add(time.Hour))
+	if err = RefreshGroupList(config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err = ReadGroupList(testStore)
+	if err != nil || len(groups) != 3 || groups[1].Name != "test.new" || groups[1].Description != "Brand new" {
+		t.Errorf("group list after NEWGROUPS is %v (%v)", groups, err)
+	}
+
+	if found := SearchGroupList(groups, "OTHER"); len(found) != 1 || found[0].Name != "test.other" {
+		t.Errorf("search finds %v", found)
+	}
+
+	// subscriptions start out from the configuration
+	config["groups"] = "test.group, test.other"
+	subscribed, err := Subscribe(config, "test.new")
+	if err != nil || len(subscribed) != 3 {
+		t.Errorf("subscribed to %v (%v)", subscribed, err)
+	}
+
+	subscribed, err = Unsubscribe(config, "test.group")
+	if err != nil || len(subscribed) != 2 {
+		t.Errorf("subscribed to %v (%v)", subscribed, err)
+	}
+
+	subscribed, err = ReadSubscriptions(config)
+	if err != nil || len(subscribed) != 2 || subscribed[0] != "test.other" || subscribed[1] != "test.new" {
+		t.Errorf("subscriptions file contains %v (%v)", subscribed, err)
+	}
+}
+
+// Subscriptions change only through our own forms, and only to
+// groups we know of.
+func TestSubscribeFromUI(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+	server.AddGroup("test.other", "Other things", time.Now().Add(-time.Hour))
+
+	config := server.Config()
+	if err := RefreshGroupList(config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newState(config)
+	subscribedTo := func(group string) bool {
+		groups, err := SubscribedGroups(config)
+		return err == nil && contains(groups, group)
+	}
+
+	get(s, url.Values{"view": {"groups"}, "subscribe": {"test.other"}})
+	if subscribedTo("test.other") {
+		t.Errorf("subscribed by a GET request")
+	}
+
+	page := post(s, "groups", "http://evil.example", url.Values{"subscribe": {"test.other"}})
+	if subscribedTo("test.other") || !strings.Contains(page, "only be changed") {
+		t.Errorf("subscribed from another site: %s", page)
+	}
+
+	page = post(s, "groups", "http://example.com", url.Values{"subscribe": {"*"}})
+	if subscribedTo("*") || !strings.Contains(page, "unknown group") {
+		t.Errorf("subscribed to an unknown group: %s", page)
+	}
+
+	post(s, "groups", "http://example.com", url.Values{"subscribe": {"test.other"}})
+	if !subscribedTo("test.other") {
+		t.Errorf("not subscribed from the group list")
+	}
+
+	post(s, "groups", "http://example.com", url.Values{"unsubscribe": {"test.other"}})
+	if subscribedTo("test.other") {
+		t.Errorf("not unsubscribed from the group list")
+	}
+}
@@ -22,8 +22,8 @@ func FinalScreen(out io.Writer) {
 }
 
 // Produces HTML for an initial screen listing all subscribed
-// groups.
-func InitialScreen(groups []string, out io.Writer) {
+// groups with their numbers of unread articles.
+func InitialScreen(groups []string, unread map[string]int, out io.Writer) {
 	template1 :=
 		`<html>
     <head>
@@ -32,17 +32,23 @@ func InitialScreen(groups []string, out io.Writer) {
     <body>
         <h1>Your subscribed groups</h1>
         <ul>
-            {{range .}}
-                <li><big><big><big><a href="?arg={{.}}&view=group">{{.}}</a></big></big></big></li>
+            {{range .Groups}}
+                <li><big><big><big><a href="?arg={{.}}&view=group">{{.}}</a></big></big></big> ({{index $.Unread .}} unread)</li>
             {{else}}
                 Nothing?
             {{end}}
         </ul>
+        <big><big><big><a href="?view=groups">All groups</a></big></big></big>
+        <big><big><big><a href="?view=search">Search the server</a></big></big></big>
+        <big><big><big><a href="?view=outbox">Outbox</a></big></big></big>
         <big><big><big><a href="?view=quit">Quit</a></big></big></big>
     </body>
 </html>`
 	tmpl := template.Must(template.New("initial").Parse(template1))
-	err := tmpl.Execute(out, groups)
+	err := tmpl.Execute(out, struct {
+		Groups []string
+		Unread map[string]int
+	}{groups, unread})
 
 	if err != nil {
 		panic(err)
@@ -55,6 +61,8 @@ func GroupOverview(group string, containers map[*Container]bool, out io.Writer)
 		Name     string
 		Articles chan template.HTML
 		Back     string
+		Compose  string
+		Search   string
 	}
 
 	template1 :=
@@ -65,6 +73,8 @@ func GroupOverview(group string, containers map[*Container]bool, out io.Writer)
     <body>
         <big><big><big><a href="{{.Back}}">Back</a></big></big></big></big></big></big>
         <h1>Overview {{.Name}}</h1>
+        <a href="{{.Compose}}">New article</a>
+        <a href="{{.Search}}">Search the server</a>
         <ul>
             {{range .Articles}}
                 <li>{{.}}</li>
@@ -83,10 +93,24 @@ func GroupOverview(group string, containers map[*Container]bool, out io.Writer)
 			"view": {"overview"},
 		}.Encode()}
 
+	composeUrl := url.URL{
+		RawQuery: url.Values{
+			"view":  {"compose"},
+			"group": {group},
+		}.Encode()}
+
+	searchUrl := url.URL{
+		RawQuery: url.Values{
+			"view":  {"search"},
+			"group": {group},
+		}.Encode()}
+
 	data := tmp{
 		Name:     group,
 		Articles: ch,
 		Back:     backUrl.String(),
+		Compose:  composeUrl.String(),
+		Search:   searchUrl.String(),
 	}
 
 	err := tmpl.Execute(out, data)
@@ -150,13 +174,16 @@ func representContainer(cont *Container, depth int) template.HTML {
 // Since it's not possible to find out from the container which
 // group it belongs to (it could have several groups listed in
 // cont.Article.OtherHeaders["Newsgroups"]), we need to provide this
-// information.
-func ShowArticle(cont *Container, fromGroup string, out io.Writer) {
+// information. A starred article is spared by expiry (see
+// RetentionPolicy).
+func ShowArticle(cont *Container, fromGroup string, starred bool, out io.Writer) {
 	type tmp struct {
 		*Container
 		SanitizedText template.HTML
 		Next, Back    template.HTML // some links
-		HasNext       bool          // is Next set?
+		Reply, Star   template.HTML
+		HasNext       bool // is Next set?
+		Starred       bool
 	}
 	template1 :=
 		`<html>
@@ -180,6 +207,11 @@ func ShowArticle(cont *Container, fromGroup string, out io.Writer) {
         </table>
         <h1>{{.Article.Subject}} <i>{{.Article.OtherHeaders.From}}</i></h1>
 <pre>{{.SanitizedText}}</pre>
+        <a href="{{.Reply}}">Reply</a>
+        <form method="post" action="{{.Star}}" style="display: inline">
+            <input type="hidden" name="star" value="{{if .Starred}}false{{else}}true{{end}}">
+            <input type="submit" value="{{if .Starred}}Unstar{{else}}Star{{end}}">
+        </form>
         <table width="100%">
             <tr>
                 <td align="left" width="80%">{{if .HasNext}}<big><big><big><a href="{{.Next}}">Next</a></big></big></big>{{else}}No Next{{end}}</td>
@@ -194,7 +226,6 @@ func ShowArticle(cont *Container, fromGroup string, out io.Writer) {
 	tmpl := template.Must(template.New("article").Parse(template1))
 
 	valuesBack := url.Values{}
-	valuesBack.Set("delete", string(cont.Article.Id))
 	valuesBack.Set("view", "group")
 	valuesBack.Set("arg", fromGroup)
 
@@ -203,7 +234,6 @@ func ShowArticle(cont *Container, fromGroup string, out io.Writer) {
 	// find next article
 	var next *Container
 	if next = cont.Secondary; next != nil && next.Article != nil {
-		valuesNext.Set("delete", string(cont.Article.Id))
 		valuesNext.Set("view", "article")
 		if next != nil {
 			valuesNext.Set("arg", string(next.Article.Id))
@@ -218,10 +248,167 @@ func ShowArticle(cont *Container, fromGroup string, out io.Writer) {
 		RawQuery: valuesNext.Encode(),
 	}
 
+	urlReply := url.URL{
+		RawQuery: url.Values{
+			"view":  {"compose"},
+			"group": {fromGroup},
+			"arg":   {string(cont.Article.Id)},
+		}.Encode(),
+	}
+
+	urlStar := url.URL{
+		RawQuery: url.Values{
+			"view": {"article"},
+			"arg":  {string(cont.Article.Id)},
+		}.Encode(),
+	}
+
 	text := RepresentArticle(*cont.Article)
 	data := tmp{cont, text,
 		template.HTML(urlNext.String()), template.HTML(urlBack.String()),
-		next != nil}
+		template.HTML(urlReply.String()), template.HTML(urlStar.String()),
+		next != nil, starred}
+	err := tmpl.Execute(out, data)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Shows a form for editing draft, which is saved in the outbox
+// under name (or not yet saved, if name is empty). It is sent to
+// ?view=post.
+func ComposeScreen(draft Draft, name string, out io.Writer) {
+	type tmp struct {
+		Draft
+		Name string
+	}
+
+	template1 :=
+		`<html>
+    <head>
+        <title>Loread — {{if .Subject}}{{.Subject}}{{else}}New article{{end}}</title>
+    </head>
+    <body>
+        <big><big><big><a href="?view=overview">Back</a></big></big></big>
+        <form method="post" action="?view=post">
+            <table>
+                <tr><td>From</td><td><input name="from" size="80" value="{{.From}}"></td></tr>
+                <tr><td>Newsgroups</td><td><input name="newsgroups" size="80" value="{{.Newsgroups}}"></td></tr>
+                <tr><td>Subject</td><td><input name="subject" size="80" value="{{.Subject}}"></td></tr>
+            </table>
+            <input type="hidden" name="references" value="{{.References}}">
+            <input type="hidden" name="draft" value="{{.Name}}">
+            <textarea name="body" rows="30" cols="80">{{.Body}}</textarea>
+            <br>
+            <input type="submit" name="action" value="Send">
+            <input type="submit" name="action" value="Save to outbox">
+        </form>
+    </body>
+</html>`
+
+	tmpl := template.Must(template.New("compose").Parse(template1))
+	err := tmpl.Execute(out, tmp{draft, name})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Tells whether posting worked; err is the result of SendDraft.
+// Unless it worked, the article is still in the outbox.
+func PostResultScreen(err error, out io.Writer) {
+	type tmp struct {
+		Posted  bool
+		Refused bool // by the server (as opposed to not reaching it)
+		Reason  string
+		Error   string
+	}
+
+	template1 :=
+		`<html>
+    <head>
+        <title>Loread — Posting</title>
+    </head>
+    <body>
+        {{if .Posted}}
+            <h1>Your article has been posted.</h1>
+        {{else if .Refused}}
+            <h1>{{.Reason}}</h1>
+            The server said: {{.Error}}. Your article stays in the
+            <a href="?view=outbox">outbox</a>.
+        {{else}}
+            <h1>Couldn't reach the server</h1>
+            ({{.Error}}) Your article stays in the <a href="?view=outbox">outbox</a>
+            and will be sent next time.
+        {{end}}
+        <big><big><big><a href="?view=overview">Main Screen</a></big></big></big>
+    </body>
+</html>`
+
+	data := tmp{Posted: err == nil, Reason: "Posting failed"}
+	if e, ok := err.(*Error); ok {
+		data.Refused = true
+		if e.Code == POSTING_NOT_ALLOWED {
+			data.Reason = "Posting is not allowed"
+		}
+	}
+
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	tmpl := template.Must(template.New("posted").Parse(template1))
+	err = tmpl.Execute(out, data)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Lists the articles waiting in the outbox.
+func OutboxScreen(entries []OutboxEntry, out io.Writer) {
+	type tmp struct {
+		OutboxEntry
+		Edit string
+	}
+
+	template1 :=
+		`<html>
+    <head>
+        <title>Loread — Outbox</title>
+    </head>
+    <body>
+        <big><big><big><a href="?view=overview">Back</a></big></big></big>
+        <h1>Outbox</h1>
+        <ul>
+            {{range .}}
+                <li>
+                    <form method="post" action="?view=outbox">
+                        <a href="{{.Edit}}">{{.Draft.Subject}}</a> ({{.Draft.Newsgroups}})
+                        <input type="hidden" name="remove" value="{{.Name}}">
+                        <input type="submit" value="Delete">
+                    </form>
+                    {{if .Error}}<br><i>Refused: {{.Error}}</i>{{end}}
+                </li>
+            {{else}}
+                Nothing to send.
+            {{end}}
+        </ul>
+        <form method="post" action="?view=outbox">
+            <input type="hidden" name="send" value="yes">
+            <input type="submit" value="Send all now">
+        </form>
+    </body>
+</html>`
+
+	data := make([]tmp, len(entries))
+	for i, entry := range entries {
+		edit := url.URL{RawQuery: url.Values{"view": {"compose"}, "draft": {entry.Name}}.Encode()}
+		data[i] = tmp{entry, edit.String()}
+	}
+
+	tmpl := template.Must(template.New("outbox").Parse(template1))
 	err := tmpl.Execute(out, data)
 
 	if err != nil {
@@ -229,6 +416,156 @@ func ShowArticle(cont *Container, fromGroup string, out io.Writer) {
 	}
 }
 
+// Lists the groups from the server's group list matching search,
+// with buttons for subscribing to or unsubscribing from them.
+func GroupListScreen(groups []ActiveGroup, search string, subscribed []string, out io.Writer) {
+	type tmp struct {
+		ActiveGroup
+		Subscribed bool
+	}
+
+	template1 :=
+		`<html>
+    <head>
+        <title>Loread — All groups</title>
+    </head>
+    <body>
+        <big><big><big><a href="?view=overview">Back</a></big></big></big>
+        <h1>All groups</h1>
+        <form action="/" method="get">
+            <input type="hidden" name="view" value="groups">
+            <input name="search" size="40" value="{{.Search}}">
+            <input type="submit" value="Search">
+        </form>
+        <ul>
+            {{range .Groups}}
+                <li>
+                    <form method="post" action="?view=groups">
+                        {{if .Subscribed}}<b>{{.Name}}</b>{{else}}{{.Name}}{{end}}
+                        {{.Description}}
+                        <input type="hidden" name="{{if .Subscribed}}unsubscribe{{else}}subscribe{{end}}" value="{{.Name}}">
+                        <input type="hidden" name="search" value="{{$.Search}}">
+                        <input type="submit" value="{{if .Subscribed}}Unsubscribe{{else}}Subscribe{{end}}">
+                    </form>
+                </li>
+            {{else}}
+                No such group.
+            {{end}}
+        </ul>
+        {{if .More}}{{.More}} more; please refine your search.{{end}}
+        <a href="?view=groups&amp;refresh=yes">Fetch the whole list again</a>
+    </body>
+</html>`
+
+	// there may be tens of thousands
+	const MAX_SHOWN = 500
+	more := 0
+	if len(groups) > MAX_SHOWN {
+		more = len(groups) - MAX_SHOWN
+		groups = groups[:MAX_SHOWN]
+	}
+
+	isSubscribed := make(map[string]bool)
+	for _, group := range subscribed {
+		isSubscribed[group] = true
+	}
+
+	data := make([]tmp, len(groups))
+	for i, group := range groups {
+		data[i] = tmp{group, isSubscribed[group.Name]}
+	}
+
+	tmpl := template.Must(template.New("groups").Parse(template1))
+	err := tmpl.Execute(out, struct {
+		Groups []tmp
+		Search string
+		More   int
+	}{data, search, more})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Shows a form for searching the server (see Client.Search) and
+// the results of the last search, with buttons for fetching them.
+// local tells which of them we already have; servers are the
+// sections to choose from (see Servers).
+func SearchScreen(groups, servers []string, group, server, field, text string, results []SearchResult,
+	local map[int]bool, out io.Writer) {
+	type tmp struct {
+		SearchResult
+		Local bool
+	}
+
+	template1 :=
+		`<html>
+    <head>
+        <title>Loread — Search</title>
+    </head>
+    <body>
+        <big><big><big><a href="?view=overview">Back</a></big></big></big>
+        <h1>Search the server</h1>
+        <form action="/" method="get">
+            <input type="hidden" name="view" value="search">
+            <select name="group">
+                {{range .Groups}}<option{{if eq . $.Group}} selected{{end}}>{{.}}</option>{{end}}
+            </select>
+            <select name="field">
+                {{range .Fields}}<option{{if eq . $.Field}} selected{{end}}>{{.}}</option>{{end}}
+            </select>
+            <input name="text" size="40" value="{{.Text}}">
+            {{if gt (len .Servers) 1}}
+                on <select name="server">
+                    {{range .Servers}}<option{{if eq . $.Server}} selected{{end}}>{{.}}</option>{{end}}
+                </select>
+            {{end}}
+            <input type="submit" value="Search">
+        </form>
+        {{if .Text}}
+            <ul>
+                {{range .Results}}
+                    <li>
+                        <form method="post" action="?view=search">
+                            {{.Number}}: {{.Value}}
+                            {{if .Local}}
+                                (saved)
+                            {{else}}
+                                <input type="hidden" name="group" value="{{$.Group}}">
+                                <input type="hidden" name="server" value="{{$.Server}}">
+                                <input type="hidden" name="field" value="{{$.Field}}">
+                                <input type="hidden" name="text" value="{{$.Text}}">
+                                <input type="hidden" name="fetch" value="{{.Number}}">
+                                <input type="submit" value="Fetch">
+                            {{end}}
+                        </form>
+                    </li>
+                {{else}}
+                    Nothing found.
+                {{end}}
+            </ul>
+            <a href="?view=group&amp;arg={{.Group}}">Show {{.Group}}</a>
+        {{end}}
+    </body>
+</html>`
+
+	data := make([]tmp, len(results))
+	for i, result := range results {
+		data[i] = tmp{result, local[result.Number]}
+	}
+
+	tmpl := template.Must(template.New("search").Parse(template1))
+	err := tmpl.Execute(out, struct {
+		Groups, Servers, Fields    []string
+		Group, Server, Field, Text string
+		Results                    []tmp
+	}{groups, servers, SEARCH_FIELDS, group, server, field, text, data})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
 // Displays an error page showing err (as formatted via
 // fmt.Sprintf's %+v control)
 func ErrorPage(err interface{}, out io.Writer) {
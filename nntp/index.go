@@ -0,0 +1,311 @@
+package nntp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Data at the root of the store in which IndexedStore keeps its
+// index.
+const MESSAGE_ID_INDEX = ".msgid-index"
+
+// Where an article is saved (see ArticleStore.Lookup).
+type IndexEntry struct {
+	Group  string
+	Number int    // on the server it came from
+	Name   string // see ArticleName
+}
+
+// An ArticleStore keeping an index of the Message-IDs of all
+// articles (except those in OUTBOX), so that they can be found in
+// every group without reading them. The index is a log in the
+// data MESSAGE_ID_INDEX: every line adds („<id> group name“,
+// separated by tabs) or removes („-<id> group name“) an entry; it
+// is written anew when most of its lines are obsolete. If there's
+// no index yet, it is built from the saved articles. Other
+// processes (e. g. „loread expire“ while the server runs) may
+// change it, too; it is read again when its file changes.
+type IndexedStore struct {
+	ArticleStore
+
+	mu      sync.Mutex
+	entries map[MessageId][]IndexEntry // nil until loaded
+	stamp   indexStamp                 // of the index as we know it
+}
+
+// size and modification time of the index's file
+type indexStamp struct {
+	size     int64
+	modified time.Time
+}
+
+// stores opened by OpenStore, by their absolute root; sharing
+// them keeps their indexes up to date
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*IndexedStore)
+)
+
+// The store configured by „spool“ (a DirStore with an index).
+func OpenStore(config map[string]string) *IndexedStore {
+	root, err := filepath.Abs(config["spool"])
+	if err != nil {
+		root = config["spool"]
+	}
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if store, ok := stores[root]; ok {
+		return store
+	}
+
+	store := &IndexedStore{ArticleStore: DirStore{root}}
+	stores[root] = store
+	return store
+}
+
+func (s *IndexedStore) Put(group, name string, article RawArticle) error {
+	err := s.ArticleStore.Put(group, name, article)
+	id := articleId(string(article))
+	if err != nil || group == OUTBOX || id == "" {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.load()
+	if err != nil {
+		return err
+	}
+
+	no, _ := splitArticleName(name)
+	entry := IndexEntry{group, no, name}
+	if !s.add(id, entry) {
+		return nil
+	}
+
+	return s.append(indexLine("", id, entry))
+}
+
+func (s *IndexedStore) Delete(group, name string) error {
+	var article RawArticle
+	if group != OUTBOX && !strings.HasPrefix(name, ".") {
+		article, _ = s.ArticleStore.Get(group, name)
+	}
+
+	err := s.ArticleStore.Delete(group, name)
+	id := articleId(string(article))
+	if err != nil || id == "" {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.load()
+	if err != nil {
+		return err
+	}
+
+	no, _ := splitArticleName(name)
+	entry := IndexEntry{group, no, name}
+	s.remove(id, entry)
+	return s.append(indexLine("-", id, entry))
+}
+
+func (s *IndexedStore) GetById(group string, id MessageId) (RawArticle, string, error) {
+	entries, err := s.Lookup(id)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, entry := range entries {
+		if entry.Group == group {
+			article, err := s.Get(group, entry.Name)
+			return article, entry.Name, err
+		}
+	}
+
+	return "", "", os.ErrNotExist
+}
+
+func (s *IndexedStore) Lookup(id MessageId) ([]IndexEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]IndexEntry(nil), s.entries[id]...), nil
+}
+
+// Builds the index anew from the saved articles.
+func (s *IndexedStore) Reindex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reindex()
+}
+
+// Reads the index, unless that has already happened and it
+// hasn't changed since; must be called with s.mu held.
+func (s *IndexedStore) load() error {
+	stamp := s.indexStamp()
+	if s.entries != nil && stamp == s.stamp {
+		return nil
+	}
+
+	s.stamp = stamp
+	data, err := s.ArticleStore.ReadData("", MESSAGE_ID_INDEX)
+	if os.IsNotExist(err) {
+		return s.reindex()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.entries = make(map[MessageId][]IndexEntry)
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+
+		no, _ := splitArticleName(fields[2])
+		entry := IndexEntry{fields[1], no, fields[2]}
+		if id := MessageId(fields[0]); strings.HasPrefix(fields[0], "-") {
+			s.remove(id[1:], entry)
+		} else {
+			s.add(id, entry)
+		}
+	}
+
+	live := 0
+	for _, entries := range s.entries {
+		live += len(entries)
+	}
+
+	if len(lines) > 2*live+100 {
+		return s.write()
+	}
+
+	return nil
+}
+
+// See Reindex; must be called with s.mu held.
+func (s *IndexedStore) reindex() error {
+	s.entries = make(map[MessageId][]IndexEntry)
+
+	groups, err := s.ArticleStore.Groups()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, group := range groups {
+		if group == OUTBOX {
+			continue
+		}
+
+		raw, names, err := GetArticles(s.ArticleStore, group)
+		if err != nil {
+			return err
+		}
+
+		for i, article := range raw {
+			if id := articleId(string(article)); id != "" {
+				no, _ := splitArticleName(names[i])
+				s.add(id, IndexEntry{group, no, names[i]})
+			}
+		}
+	}
+
+	return s.write()
+}
+
+// Replaces the index with s.entries; must be called with s.mu
+// held.
+func (s *IndexedStore) write() error {
+	lines := make([]string, 0, len(s.entries))
+	for id, entries := range s.entries {
+		for _, entry := range entries {
+			lines = append(lines, indexLine("", id, entry))
+		}
+	}
+
+	sort.Strings(lines)
+	err := s.ArticleStore.WriteData("", MESSAGE_ID_INDEX, []byte(strings.Join(lines, "")))
+	s.stamp = s.indexStamp()
+	return err
+}
+
+// Adds line to the index; must be called with s.mu held.
+func (s *IndexedStore) append(line string) error {
+	err := s.ArticleStore.AppendData("", MESSAGE_ID_INDEX, []byte(line))
+	s.stamp = s.indexStamp()
+	return err
+}
+
+// The stamp of the index's file, if the store keeps it in one
+// (a DirStore does); the zero stamp otherwise.
+func (s *IndexedStore) indexStamp() indexStamp {
+	dir, ok := s.ArticleStore.(DirStore)
+	if !ok {
+		return indexStamp{}
+	}
+
+	path, err := dir.path("", MESSAGE_ID_INDEX)
+	if err != nil {
+		return indexStamp{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return indexStamp{}
+	}
+
+	return indexStamp{info.Size(), info.ModTime()}
+}
+
+// Adds entry, unless it's already there; must be called with
+// s.mu held.
+func (s *IndexedStore) add(id MessageId, entry IndexEntry) bool {
+	for _, e := range s.entries[id] {
+		if e == entry {
+			return false
+		}
+	}
+
+	s.entries[id] = append(s.entries[id], entry)
+	return true
+}
+
+// must be called with s.mu held
+func (s *IndexedStore) remove(id MessageId, entry IndexEntry) {
+	rest := make([]IndexEntry, 0, len(s.entries[id]))
+	for _, e := range s.entries[id] {
+		if e != entry {
+			rest = append(rest, e)
+		}
+	}
+
+	if len(rest) == 0 {
+		delete(s.entries, id)
+	} else {
+		s.entries[id] = rest
+	}
+}
+
+// A line of the index; prefix is "-" for removing entry.
+func indexLine(prefix string, id MessageId, entry IndexEntry) string {
+	return prefix + string(id) + "\t" + entry.Group + "\t" + entry.Name + "\n"
+}
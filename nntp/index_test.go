@@ -0,0 +1,137 @@
+package nntp
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The index is built for an existing spool, kept up to date and
+// read back by the next process.
+func TestIndexedStore(t *testing.T) {
+	defer inTempDir(t)()
+
+	testStore.Put("test.group", "1", "Message-ID: <1@test>\n\nbody")
+	testStore.Put("other.group", "7.paid", "Message-ID: <1@test>\n\nbody")
+	testStore.Put(OUTBOX, "draft", "Message-ID: <draft@test>\n\nbody")
+
+	store := &IndexedStore{ArticleStore: DirStore{"."}}
+	entries, err := store.Lookup("<1@test>")
+	want := []IndexEntry{{"other.group", 7, "7.paid"}, {"test.group", 1, "1"}}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("<1@test> is in %+v (%v), not %+v", entries, err, want)
+	}
+
+	if entries, _ := store.Lookup("<draft@test>"); len(entries) != 0 {
+		t.Errorf("drafts shouldn't be indexed: %+v", entries)
+	}
+
+	if err := store.Put("test.group", "2", "Message-ID: <2@test>\n\nbody"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete("other.group", "7.paid"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new process
+	store = &IndexedStore{ArticleStore: DirStore{"."}}
+	if entries, _ := store.Lookup("<1@test>"); !reflect.DeepEqual(entries, want[1:]) {
+		t.Errorf("<1@test> is in %+v after deleting, not %+v", entries, want[1:])
+	}
+
+	article, name, err := store.GetById("test.group", "<2@test>")
+	if err != nil || name != "2" || !strings.Contains(string(article), "<2@test>") {
+		t.Errorf("<2@test> is %q under %q (%v)", article, name, err)
+	}
+
+	if _, _, err := store.GetById("other.group", "<1@test>"); err == nil {
+		t.Errorf("deleted article is still found")
+	}
+}
+
+// Articles can be shown without visiting their group first.
+func TestArticleById(t *testing.T) {
+	defer inTempDir(t)()
+
+	testStore.Put("test.group", "3", "Subject: found\nMessage-ID: <3@test>\n\nbody")
+	s := newState(map[string]string{})
+	page := get(s, url.Values{"view": {"article"}, "arg": {"<3@test>"}})
+	if !strings.Contains(page, "found") {
+		t.Errorf("article not shown: %s", page)
+	}
+
+	if state, _ := GetReadState(testStore, "test.group"); !state.IsRead("", 3, "") {
+		t.Errorf("article not marked as read: %+v", state)
+	}
+}
+
+// Changes made by another process (e. g. „loread expire“ while
+// the server runs) are noticed.
+func TestIndexChanged(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := &IndexedStore{ArticleStore: DirStore{"."}}
+	other := &IndexedStore{ArticleStore: DirStore{"."}}
+	if err := server.Put("test.group", "1", "Message-ID: <1@test>\n\nbody"); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := other.Lookup("<1@test>"); len(entries) != 1 {
+		t.Fatalf("<1@test> not found by the other process: %+v", entries)
+	}
+
+	other.Put("test.group", "2", "Message-ID: <2@test>\n\nbody")
+	other.Delete("test.group", "1")
+	if entries, _ := server.Lookup("<2@test>"); len(entries) != 1 || entries[0].Name != "2" {
+		t.Errorf("new article not noticed: %+v", entries)
+	}
+
+	if entries, _ := server.Lookup("<1@test>"); len(entries) != 0 {
+		t.Errorf("deleted article not noticed: %+v", entries)
+	}
+
+	// articles put by hand
+	testStore.Put("test.group", "3", "Message-ID: <3@test>\n\nbody")
+	if err := other.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := server.Lookup("<3@test>"); len(entries) != 1 {
+		t.Errorf("reindexing not noticed: %+v", entries)
+	}
+}
+
+// Stars change only through the button on our own article page.
+func TestStarFromUI(t *testing.T) {
+	defer inTempDir(t)()
+
+	testStore.Put("test.group", "3", "Subject: found\nMessage-ID: <3@test>\n\nbody")
+	s := newState(map[string]string{})
+	view := "article&arg=" + url.QueryEscape("<3@test>")
+	isStarred := func() bool {
+		starred, _ := GetStarred(testStore, "test.group")
+		return starred["<3@test>"]
+	}
+
+	get(s, url.Values{"view": {"article"}, "arg": {"<3@test>"}, "star": {"true"}})
+	if isStarred() {
+		t.Errorf("starred by a GET request")
+	}
+
+	page := post(s, view, "http://evil.example", url.Values{"star": {"true"}})
+	if isStarred() || !strings.Contains(page, "only be changed") {
+		t.Errorf("starred from another site: %s", page)
+	}
+
+	page = post(s, view, "http://example.com", url.Values{"star": {"true"}})
+	if !isStarred() || !strings.Contains(page, "Unstar") {
+		t.Errorf("not starred from the article page: %s", page)
+	}
+
+	post(s, view, "http://example.com", url.Values{"star": {"false"}})
+	if isStarred() {
+		t.Errorf("not unstarred from the article page")
+	}
+}
@@ -1,19 +1,30 @@
 package nntp
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"strings"
+	"sync"
 	"time"
 )
 
 type state struct {
-	groups         []string             // subscribed groups
-	paths          map[MessageId]string // maps message ids to their paths
-	deleteMessages []MessageId          // messages to be deleted
-	messages       map[*Container]bool  // messages in current group
-	group          string               // group currently being visited
+	mu       sync.Mutex                   // requests are served concurrently
+	config   map[string]string            // as read from config.txt
+	store    ArticleStore                 // see „spool“
+	groups   []string                     // subscribed groups
+	pending  map[MessageId]pendingArticle // messages known only from overview data
+	messages map[*Container]bool          // messages in current group
+	group    string                       // group currently being visited
+}
+
+// where to fetch an article from that we only know from its
+// overview data
+type pendingArticle struct {
+	server string // see Servers
+	number int
 }
 
 var exit = make(chan bool, 0)
@@ -25,17 +36,32 @@ func Main() {
 		panic(err)
 	}
 
-	FetchArticles(conf)
-	groups := strings.Split(conf["groups"], ", ")
+	// a command instead of fetching and serving
+	if len(os.Args) > 1 {
+		err = command(conf, os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
 
-	s := state{
-		groups:         groups,
-		paths:          make(map[MessageId]string),
-		group:          "",
-		deleteMessages: make([]MessageId, 0),
+	err = FetchArticles(conf)
+	if err != nil {
+		// we can still show what we have
+		log.Printf("couldn't fetch articles: %s", err)
+	} else if conf["fetch-mode"] == FETCH_OVERVIEW && conf["fetch-bodies"] == BODIES_BACKGROUND {
+		go func() {
+			err := FetchBodies(conf)
+			if err != nil {
+				log.Printf("couldn't fetch bodies: %s", err)
+			}
+		}()
 	}
 
-	http.Handle("/", &s)
+	s := newState(conf)
+
+	http.Handle("/", s)
 	go func() {
 		err = http.ListenAndServe(":8080", nil)
 		log.Fatal(err)
@@ -45,22 +71,73 @@ func Main() {
 	time.Sleep(time.Second * time.Duration(3))
 }
 
-func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
-	v := request.URL.Query()
+// Runs the command name given on the command line:
+// „import-newsrc [file]“ or „export-newsrc [file]“ (default: see
+// „newsrc“) or „expire“ (see Expire).
+func command(conf map[string]string, name string, args []string) error {
+	switch name {
+	case "import-newsrc":
+		return ImportNewsrc(conf, newsrcFile(conf, args))
+
+	case "export-newsrc":
+		return ExportNewsrc(conf, newsrcFile(conf, args))
+
+	case "expire":
+		report, err := Expire(conf)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("expired %d articles, reclaimed %d bytes\n", report.Articles, report.Bytes)
+		return nil
+
+	case "reindex":
+		return OpenStore(conf).Reindex()
+
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
 
-	// if there's a delete request, add to delete list
-	del, ok := v["delete"]
+func newState(conf map[string]string) *state {
+	groups, err := SubscribedGroups(conf)
+	if err != nil {
+		log.Printf("couldn't read subscriptions: %s", err)
+	}
 
-	if ok && len(del) > 0 {
-		s.deleteMessages = append(s.deleteMessages, MessageId(del[0]))
+	return &state{
+		config:  conf,
+		store:   OpenStore(conf),
+		groups:  groups,
+		pending: make(map[MessageId]pendingArticle),
+		group:   "",
 	}
+}
+
+func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
+	// one at a time: nearly every view reads or changes the current
+	// group, its messages or the pending articles
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := request.URL.Query()
 
 	// Serve. The action depends on view.
 	switch operation, ok := v["view"]; {
 	case !ok || len(operation) == 0:
 		fallthrough
 	case operation[0] == "overview":
-		InitialScreen(s.groups, out)
+		unread := make(map[string]int, len(s.groups))
+		for _, group := range s.groups {
+			count, err := CountUnread(s.config, s.store, group)
+			if err != nil {
+				log.Printf("couldn't count unread articles of %s: %s", group, err)
+			}
+
+			unread[group] = count
+		}
+
+		InitialScreen(s.groups, unread, out)
 
 	case operation[0] == "group":
 		group, ok := v["arg"]
@@ -68,7 +145,7 @@ func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
 			ErrorPageF(out, "no arg provided in query %s", request.URL.String())
 		}
 
-		raw, paths, err := GetArticles(group[0])
+		raw, _, err := GetArticles(s.store, group[0])
 
 		if err != nil {
 			ErrorPage(err, out)
@@ -76,10 +153,36 @@ func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
 		}
 
 		articles := make([]ParsedArticle, len(raw))
+		saved := make(map[MessageId]bool, len(raw))
 
 		for i := range raw {
 			articles[i] = FormatArticle(raw[i])
-			s.paths[articles[i].Id] = paths[i]
+			saved[articles[i].Id] = true
+		}
+
+		// add articles we only know from their overview data (maybe
+		// from several servers)
+		var err2 error
+		seen := make(map[MessageId]bool)
+		for _, server := range Servers(s.config) {
+			records, err := ReadOverview(s.store, group[0], server["section"])
+			if err != nil {
+				err2 = err
+				break
+			}
+
+			for _, record := range records {
+				if !saved[record.Id] && !seen[record.Id] {
+					seen[record.Id] = true
+					articles = append(articles, record.Parsed())
+					s.pending[record.Id] = pendingArticle{server["section"], record.Number}
+				}
+			}
+		}
+
+		if err2 != nil {
+			ErrorPage(err2, out)
+			break
 		}
 
 		containers := Thread(articles)
@@ -88,6 +191,12 @@ func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
 		GroupOverview(group[0], containers, out)
 
 	case operation[0] == "article":
+		// the star button posts; see sameOriginPost
+		if request.Method == "POST" && !sameOriginPost(request) {
+			ErrorPageF(out, "stars can only be changed from the article page")
+			break
+		}
+
 		arg, ok := v["arg"]
 
 		if !ok || len(arg) == 0 {
@@ -95,20 +204,278 @@ func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
 		}
 
 		id := MessageId(arg[0])
+		group := s.group
 		container := findArticle(s.messages, id)
+
+		// not in the current group (e. g. a link from before a
+		// restart); the index knows where it is
 		if container == nil || container.Article == nil {
-			ErrorPageF(out, "article with id '%s' not found in query %s", id, request.URL.String())
-		} else {
-			ShowArticle(container, s.group, out)
+			entries, err := s.store.Lookup(id)
+			if err != nil || len(entries) == 0 {
+				ErrorPageF(out, "article with id '%s' not found in query %s", id, request.URL.String())
+				break
+			}
+
+			raw, err := s.store.Get(entries[0].Group, entries[0].Name)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+
+			article := FormatArticle(raw)
+			container = &Container{Article: &article, Id: id}
+			group = entries[0].Group
 		}
 
-	case operation[0] == "quit":
-		// delete s.deleteMessages, ignore errors
-		for _, id := range s.deleteMessages {
-			path := s.paths[id]
-			os.Remove(path)
+		// only overview data so far; download on demand
+		if p, ok := s.pending[id]; ok && group == s.group {
+			raw, err := FetchArticle(Server(s.config, p.server), s.store, group, p.number)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+
+			article := FormatArticle(raw)
+			container.Article = &article
+			delete(s.pending, id)
+		}
+
+		// saved right away, so a crash doesn't lose it
+		if name, err := savedName(s.store, group, id); err != nil {
+			log.Printf("couldn't look up %s: %s", id, err)
+		} else if name != "" {
+			err := MarkRead(s.store, group, name, container.Article, s.groups)
+			if err != nil {
+				log.Printf("couldn't mark %s as read: %s", id, err)
+			}
+		}
+
+		starred, err := GetStarred(s.store, group)
+		if err != nil {
+			ErrorPage(err, out)
+			break
+		}
+
+		if star := request.PostFormValue("star"); star != "" {
+			starred[id] = star == "true"
+			err = SetStarred(s.store, group, starred)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+		}
+
+		ShowArticle(container, group, starred[id], out)
+
+	case operation[0] == "compose":
+		draft := Draft{
+			From:       s.config["from"],
+			Newsgroups: v.Get("group"),
+		}
+
+		// a reply to an article from the current group
+		if arg := v.Get("arg"); arg != "" {
+			container := findArticle(s.messages, MessageId(arg))
+			if container == nil || container.Article == nil {
+				ErrorPageF(out, "article with id '%s' not found in query %s", arg, request.URL.String())
+				break
+			}
+
+			draft = ReplyDraft(container.Article, v.Get("group"), s.config["from"])
+		}
+
+		// editing a draft from the outbox
+		name := v.Get("draft")
+		if name != "" {
+			entry, err := ReadDraft(s.store, name)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+
+			draft = entry.Draft
 		}
 
+		ComposeScreen(draft, name, out)
+
+	case operation[0] == "post":
+		if !sameOriginPost(request) {
+			ErrorPageF(out, "posting only works from the compose form")
+			break
+		}
+
+		draft := Draft{
+			From:       request.PostFormValue("from"),
+			Newsgroups: request.PostFormValue("newsgroups"),
+			Subject:    request.PostFormValue("subject"),
+			References: request.PostFormValue("references"),
+			Body:       request.PostFormValue("body"),
+		}
+
+		// keep Message-ID and Date of an edited draft
+		name := request.PostFormValue("draft")
+		if name != "" {
+			if entry, err := ReadDraft(s.store, name); err == nil {
+				draft.Id, draft.Date = entry.Draft.Id, entry.Draft.Date
+			}
+		}
+
+		name, err := SaveDraft(s.store, draft, name)
+		if err != nil {
+			ErrorPage(err, out)
+			break
+		}
+
+		if request.PostFormValue("action") == "Send" {
+			PostResultScreen(SendDraftNow(s.config, name), out)
+			break
+		}
+
+		entries, err := ReadOutbox(s.store)
+		if err != nil {
+			ErrorPage(err, out)
+			break
+		}
+
+		OutboxScreen(entries, out)
+
+	case operation[0] == "outbox":
+		// the buttons post; see sameOriginPost
+		if request.Method == "POST" && !sameOriginPost(request) {
+			ErrorPageF(out, "the outbox can only be changed from its own page")
+			break
+		}
+
+		if name := request.PostFormValue("remove"); name != "" {
+			err := DeleteDraft(s.store, name)
+			if err != nil && !os.IsNotExist(err) {
+				ErrorPage(err, out)
+				break
+			}
+		}
+
+		if request.PostFormValue("send") != "" {
+			err := FlushOutbox(s.config)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+		}
+
+		entries, err := ReadOutbox(s.store)
+		if err != nil {
+			ErrorPage(err, out)
+			break
+		}
+
+		OutboxScreen(entries, out)
+
+	case operation[0] == "groups":
+		// the buttons post; see sameOriginPost
+		if request.Method == "POST" && !sameOriginPost(request) {
+			ErrorPageF(out, "subscriptions can only be changed from the group list")
+			break
+		}
+
+		var err error
+		subscribe, unsubscribe := request.PostFormValue("subscribe"), request.PostFormValue("unsubscribe")
+		if group := subscribe + unsubscribe; group != "" && !s.knownGroup(group) {
+			ErrorPageF(out, "unknown group %s", group)
+			break
+		}
+
+		if subscribe != "" {
+			_, err = Subscribe(s.config, subscribe)
+		} else if unsubscribe != "" {
+			_, err = Unsubscribe(s.config, unsubscribe)
+		}
+
+		if err == nil {
+			s.groups, err = SubscribedGroups(s.config)
+		}
+
+		if err != nil {
+			ErrorPage(err, out)
+			break
+		}
+
+		groups, err := ReadGroupList(s.store)
+		if err == nil && (len(groups) == 0 || v.Get("refresh") != "") {
+			err = RefreshGroupList(s.config, v.Get("refresh") != "")
+			if err == nil {
+				groups, err = ReadGroupList(s.store)
+			}
+		}
+
+		if err != nil {
+			ErrorPage(err, out)
+			break
+		}
+
+		search := request.FormValue("search")
+		GroupListScreen(SearchGroupList(groups, search), search, s.groups, out)
+
+	case operation[0] == "search":
+		group, field, text := request.FormValue("group"), request.FormValue("field"), request.FormValue("text")
+		if field == "" {
+			field = SEARCH_FIELDS[0]
+		}
+
+		// these end up in NNTP commands and the store
+		if group != "" && !s.knownGroup(group) {
+			ErrorPageF(out, "unknown group %s", group)
+			break
+		}
+
+		if !contains(SEARCH_FIELDS, field) {
+			ErrorPageF(out, "can't search %s", field)
+			break
+		}
+
+		server := searchServer(s.config, group, request.FormValue("server"))
+		if server == nil {
+			ErrorPageF(out, "unknown server %s", request.FormValue("server"))
+			break
+		}
+
+		// fetch a result into the local store (see sameOriginPost)
+		if request.Method == "POST" {
+			no := atoi(request.PostFormValue("fetch"), 0)
+			if !sameOriginPost(request) || no <= 0 || group == "" {
+				ErrorPageF(out, "results can only be fetched from the search page")
+				break
+			}
+
+			_, err := FetchArticle(server, s.store, group, no)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+		}
+
+		var results []SearchResult
+		if group != "" && text != "" {
+			var err error
+			results, err = SearchGroup(server, group, field, text)
+			if err != nil {
+				ErrorPage(err, out)
+				break
+			}
+		}
+
+		local := make(map[int]bool)
+		for _, result := range results {
+			local[result.Number] = s.store.Has(group, ArticleName(result.Number, server["section"]))
+		}
+
+		servers := make([]string, 0)
+		for _, server := range Servers(s.config) {
+			servers = append(servers, server["section"])
+		}
+
+		SearchScreen(s.groups, servers, group, server["section"], field, text, results, local, out)
+
+	case operation[0] == "quit":
 		// good bye!
 		FinalScreen(out)
 
@@ -119,6 +486,41 @@ func (s *state) ServeHTTP(out http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// Is group subscribed or in the group list? Group names from
+// the browser must be one of these.
+func (s *state) knownGroup(group string) bool {
+	if contains(s.groups, group) {
+		return true
+	}
+
+	groups, _ := ReadGroupList(s.store)
+	for _, g := range groups {
+		if g.Name == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Did request come from one of our own pages, as a POST? Any
+// other web page could make the browser send a GET (or a form)
+// here, e. g. for posting in the user's name; its Origin (or
+// Referer) header gives it away.
+func sameOriginPost(request *http.Request) bool {
+	if request.Method != "POST" {
+		return false
+	}
+
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		origin = request.Header.Get("Referer")
+	}
+
+	from, err := url.Parse(origin)
+	return err == nil && origin != "" && from.Host == request.Host
+}
+
 func findArticle(containers map[*Container]bool, id MessageId) *Container {
 	q := NewQueue()
 	for c := range containers {
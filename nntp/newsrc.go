@@ -0,0 +1,142 @@
+package nntp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A line of a .newsrc file, e. g. „comp.lang.go: 1-120,125“ for a
+// subscribed group or „alt.test! 1-5“ for an unsubscribed one.
+type NewsrcEntry struct {
+	Group      string
+	Subscribed bool
+	Read       Ranges
+}
+
+// Parses a .newsrc file; lines without „:“ or „!“ (e. g. options)
+// are ignored.
+func ParseNewsrc(text string) []NewsrcEntry {
+	rv := make([]NewsrcEntry, 0)
+	for _, line := range strings.Split(text, "\n") {
+		i := strings.IndexAny(line, ":!")
+		if i <= 0 || strings.HasPrefix(line, "options") {
+			continue
+		}
+
+		rv = append(rv, NewsrcEntry{
+			Group:      TrimWhite(line[:i]),
+			Subscribed: line[i] == ':',
+			Read:       ParseRanges(line[i+1:]),
+		})
+	}
+
+	return rv
+}
+
+// Inverse of ParseNewsrc.
+func FormatNewsrc(entries []NewsrcEntry) string {
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		marker := "!"
+		if entry.Subscribed {
+			marker = ":"
+		}
+
+		lines[i] = entry.Group + marker
+		if len(entry.Read) > 0 {
+			lines[i] += " " + entry.Read.String()
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// The file given on the command line (args), the one the
+// „newsrc“ key names, or ~/.newsrc.
+func newsrcFile(config map[string]string, args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	if config["newsrc"] != "" {
+		return config["newsrc"]
+	}
+
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".newsrc")
+}
+
+// Takes the subscriptions (replacing ours) and read articles from
+// the .newsrc file filename. Article numbers in a .newsrc belong
+// to one server; we assume that's the first one (see Server).
+func ImportNewsrc(config map[string]string, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	store := OpenStore(config)
+	server := Server(config, "")["section"]
+	subscribed := make([]string, 0)
+	for _, entry := range ParseNewsrc(string(data)) {
+		if entry.Subscribed {
+			subscribed = append(subscribed, entry.Group)
+		}
+
+		state, err := GetReadState(store, entry.Group)
+		if err != nil {
+			return err
+		}
+
+		// nothing to remember
+		if len(entry.Read) == 0 && len(state.Numbers[server]) == 0 {
+			continue
+		}
+
+		state.Numbers[server] = entry.Read
+		err = SetReadState(store, entry.Group, state)
+		if err != nil {
+			return fmt.Errorf("couldn't save read articles of %s (%w)", entry.Group, err)
+		}
+	}
+
+	return WriteSubscriptions(config, subscribed)
+}
+
+// Writes the subscribed groups (with wildmats expanded, see
+// SubscribedGroups) and the other groups we have saved something
+// for, with their read articles from the first server, to the
+// .newsrc file filename.
+func ExportNewsrc(config map[string]string, filename string) error {
+	config = Server(config, "")
+	store := OpenStore(config)
+
+	subscribed, err := SubscribedGroups(config)
+	if err != nil {
+		return err
+	}
+
+	saved, err := store.Groups()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entries := make([]NewsrcEntry, 0)
+	for _, group := range matching([]string{"*"}, append(saved, subscribed...)) {
+		if group == OUTBOX {
+			continue
+		}
+
+		state, err := GetReadState(store, group)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, NewsrcEntry{group, contains(subscribed, group), state.Numbers[config["section"]]})
+	}
+
+	return writeFileAtomically(filename, []byte(FormatNewsrc(entries)))
+}
@@ -0,0 +1,44 @@
+package nntp
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestNewsrc(t *testing.T) {
+	defer inTempDir(t)()
+
+	newsrc := "comp.lang.go: 1-120,125\nalt.test! 1-5\ncomp.lang.lisp:\n"
+	if text := FormatNewsrc(ParseNewsrc("options -n\n" + newsrc)); text != newsrc {
+		t.Errorf("%q is formatted as %q", newsrc, text)
+	}
+
+	ioutil.WriteFile("old.newsrc", []byte(newsrc), PERM_MASK)
+	config := map[string]string{"groups": "comp.lang.forth"}
+	if err := ImportNewsrc(config, "old.newsrc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if groups, err := ReadSubscriptions(config); err != nil || !reflect.DeepEqual(groups, []string{"comp.lang.go", "comp.lang.lisp"}) {
+		t.Errorf("subscribed to %v after import (%v)", groups, err)
+	}
+
+	if state, _ := GetReadState(testStore, "comp.lang.go"); !state.IsRead("", 125, "") || state.IsRead("", 121, "") {
+		t.Errorf("wrong read state after import: %+v", state)
+	}
+
+	// read something else in the meantime
+	state, _ := GetReadState(testStore, "comp.lang.lisp")
+	state.Numbers[""] = ParseRanges("3")
+	SetReadState(testStore, "comp.lang.lisp", state)
+
+	if err := ExportNewsrc(config, "new.newsrc"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "alt.test! 1-5\ncomp.lang.go: 1-120,125\ncomp.lang.lisp: 3\n"
+	if data, _ := ioutil.ReadFile("new.newsrc"); string(data) != expected {
+		t.Errorf("exported %q instead of %q", data, expected)
+	}
+}
@@ -0,0 +1,949 @@
+// An NNTP server for tests, similar to net/http/httptest. It
+// serves articles from memory (or loaded from a directory laid out
+// like loread's spool) and can misbehave on purpose.
+package nntptest
+
+import (
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decides before each command whether the server should
+// misbehave. connection counts the accepted connections, starting
+// at 1; line is the command line sent by the client, or "" for
+// the greeting. If drop is true, the connection is closed without
+// an answer; otherwise, a non-empty reply (e. g. „400 too many
+// connections“) is sent instead of the normal one. A reply
+// instead of the greeting ends the connection.
+type FaultFunc func(connection int, line string) (reply string, drop bool)
+
+// A running server.
+type Server struct {
+	Host, Port string // where the server listens
+
+	mu              sync.Mutex
+	ln              net.Listener
+	login, password string                    // see SetAuth
+	mechanisms      []string                  // see SetSASL
+	compress        bool                      // see SetCompress
+	transit         bool                      // see SetTransit
+	fault           FaultFunc                 // see SetFault
+	groups          map[string]map[int]string // group → number → article
+	descriptions    map[string]string         // for LIST NEWSGROUPS
+	created         map[string]time.Time      // for NEWGROUPS
+	posted          []string
+	connections     int
+}
+
+// Starts a server on a random port of 127.0.0.1.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &Server{
+		Host:         host,
+		Port:         port,
+		ln:           ln,
+		groups:       make(map[string]map[int]string),
+		descriptions: make(map[string]string),
+		created:      make(map[string]time.Time),
+	}
+
+	go s.serve()
+	return s, nil
+}
+
+// Stops listening; open connections are closed when their
+// clients quit.
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
+
+// Requires AUTHINFO with login and password from now on; an
+// empty login allows everyone.
+func (s *Server) SetAuth(login, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.login, s.password = login, password
+}
+
+// Offers AUTHINFO SASL with mechanisms (PLAIN and CRAM-MD5 are
+// supported) besides AUTHINFO USER; see SetAuth.
+func (s *Server) SetSASL(mechanisms ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mechanisms = mechanisms
+}
+
+// Offers COMPRESS DEFLATE (see RFC 8054) if on is set.
+func (s *Server) SetCompress(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compress = on
+}
+
+// Makes new connections start in transit mode if on is set: until
+// MODE READER, the server advertises MODE-READER instead of READER
+// and refuses reader commands.
+func (s *Server) SetTransit(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transit = on
+}
+
+// Installs f (see FaultFunc); nil makes the server behave again.
+func (s *Server) SetFault(f FaultFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fault = f
+}
+
+// Configuration (in the format of loread's config.txt) for
+// connecting to s; without SetAuth, there's no login.
+func (s *Server) Config() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return map[string]string{
+		"server": s.Host,
+		"port":   s.Port,
+		"login":  s.login,
+		"pass":   s.password,
+	}
+}
+
+// login and password; "" if AUTHINFO isn't required
+func (s *Server) auth() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.login, s.password
+}
+
+// Adds an (empty) group with description, created at the given
+// time; existing articles are kept.
+func (s *Server) AddGroup(group, description string, created time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.groups[group] == nil {
+		s.groups[group] = make(map[int]string)
+	}
+
+	s.descriptions[group] = description
+	s.created[group] = created
+}
+
+// Adds article (headers and body separated by an empty line,
+// lines separated by '\n') to group as number.
+func (s *Server) AddArticle(group string, number int, article string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.groups[group] == nil {
+		s.groups[group] = make(map[int]string)
+		s.created[group] = time.Now()
+	}
+
+	s.groups[group][number] = article
+}
+
+// Adds the articles saved in dir (one file per article, named by
+// its number, as in loread's group directories) to group.
+func (s *Server) LoadDir(group, dir string) error {
+	info, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fileInfo := range info {
+		number, err := strconv.Atoi(fileInfo.Name())
+		if err != nil {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, fileInfo.Name()))
+		if err != nil {
+			return err
+		}
+
+		s.AddArticle(group, number, string(data))
+	}
+
+	return nil
+}
+
+// Articles posted so far.
+func (s *Server) Posted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.posted...)
+}
+
+// Number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections
+}
+
+func (s *Server) serve() {
+	for {
+		raw, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.connections++
+		n := s.connections
+		s.mu.Unlock()
+
+		go s.handle(raw, n)
+	}
+}
+
+// state of one connection
+type session struct {
+	*Server
+	conn          *textproto.Conn
+	raw           net.Conn
+	compressed    bool
+	number        int    // of the connection
+	group         string // currently selected
+	user          string // given by AUTHINFO USER
+	authenticated bool
+	transit       bool // see SetTransit
+}
+
+func (s *Server) handle(raw net.Conn, number int) {
+	defer raw.Close()
+
+	sess := &session{Server: s, conn: textproto.NewConn(raw), raw: raw, number: number}
+	s.mu.Lock()
+	sess.transit = s.transit
+	s.mu.Unlock()
+
+	if replied, drop := sess.misbehave(""); replied || drop {
+		return
+	}
+
+	sess.reply("200 nntptest ready (posting allowed)")
+
+	for {
+		line, err := sess.conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		replied, drop := sess.misbehave(line)
+		if drop {
+			return
+		}
+
+		if replied {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			sess.reply("500 empty command")
+			continue
+		}
+
+		command := strings.ToUpper(fields[0])
+		if command == "QUIT" {
+			sess.reply("205 bye")
+			return
+		}
+
+		sess.dispatch(command, fields[1:])
+	}
+}
+
+// Applies the fault function; returns whether it already replied
+// and whether the connection should be dropped.
+func (sess *session) misbehave(line string) (replied, drop bool) {
+	sess.mu.Lock()
+	f := sess.fault
+	sess.mu.Unlock()
+
+	if f == nil {
+		return false, false
+	}
+
+	reply, drop := f(sess.number, line)
+	if !drop && reply != "" {
+		sess.reply("%s", reply)
+		replied = true
+	}
+
+	return replied, drop
+}
+
+func (sess *session) dispatch(command string, args []string) {
+	switch command {
+	case "CAPABILITIES":
+		sess.capabilities()
+		return
+
+	case "MODE":
+		sess.transit = false
+		sess.reply("200 reader mode")
+		return
+
+	case "COMPRESS":
+		sess.startCompression(args)
+		return
+
+	case "AUTHINFO":
+		sess.authinfo(args)
+		return
+	}
+
+	if login, _ := sess.auth(); login != "" && !sess.authenticated {
+		sess.reply("480 authentication required")
+		return
+	}
+
+	if sess.transit {
+		sess.reply("502 reader commands need MODE READER")
+		return
+	}
+
+	switch command {
+	case "GROUP":
+		sess.selectGroup(args, false)
+
+	case "LISTGROUP":
+		sess.selectGroup(args, true)
+
+	case "ARTICLE", "HEAD", "BODY", "STAT":
+		sess.article(command, args)
+
+	case "OVER", "XOVER":
+		sess.over(args)
+
+	case "HDR", "XHDR", "XPAT":
+		sess.hdr(command, args)
+
+	case "POST":
+		sess.post()
+
+	case "LIST":
+		sess.list(args)
+
+	case "NEWGROUPS":
+		sess.newGroups(args)
+
+	case "NEWNEWS":
+		sess.newNews(args)
+
+	default:
+		sess.reply("500 unknown command")
+	}
+}
+
+func (sess *session) reply(format string, args ...interface{}) {
+	sess.conn.PrintfLine(format, args...)
+}
+
+// Sends a status line followed by a multi-line block.
+func (sess *session) block(status string, lines []string) {
+	sess.reply("%s", status)
+	w := sess.conn.DotWriter()
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	w.Close()
+}
+
+func (sess *session) capabilities() {
+	caps := []string{"VERSION 2", "READER", "OVER", "HDR", "POST", "NEWNEWS"}
+	if sess.transit {
+		caps = []string{"VERSION 2", "MODE-READER", "IHAVE"}
+	}
+
+	sess.mu.Lock()
+	if sess.compress && !sess.compressed {
+		caps = append(caps, "COMPRESS DEFLATE")
+	}
+	sess.mu.Unlock()
+	if login, _ := sess.auth(); login != "" && !sess.authenticated {
+		sess.mu.Lock()
+		mechanisms := sess.mechanisms
+		sess.mu.Unlock()
+
+		if len(mechanisms) > 0 {
+			caps = append(caps, "AUTHINFO USER SASL", "SASL "+strings.Join(mechanisms, " "))
+		} else {
+			caps = append(caps, "AUTHINFO USER")
+		}
+	}
+
+	sess.block("101 capability list follows", caps)
+}
+
+func (sess *session) authinfo(args []string) {
+	if len(args) > 1 && strings.ToUpper(args[0]) == "SASL" {
+		sess.sasl(args[1:])
+		return
+	}
+
+	if len(args) != 2 {
+		sess.reply("501 syntax error")
+		return
+	}
+
+	login, password := sess.auth()
+
+	switch strings.ToUpper(args[0]) {
+	case "USER":
+		sess.user = args[1]
+		if password == "" && args[1] == login {
+			sess.authenticated = true
+			sess.reply("281 authentication accepted")
+		} else {
+			sess.reply("381 password required")
+		}
+
+	case "PASS":
+		if sess.user == login && args[1] == password {
+			sess.authenticated = true
+			sess.reply("281 authentication accepted")
+		} else {
+			sess.reply("481 authentication failed")
+		}
+
+	default:
+		sess.reply("501 unknown AUTHINFO variant")
+	}
+}
+
+// COMPRESS DEFLATE; everything after the response is compressed
+func (sess *session) startCompression(args []string) {
+	sess.mu.Lock()
+	offered := sess.compress
+	sess.mu.Unlock()
+
+	switch {
+	case !offered:
+		sess.reply("500 unknown command")
+	case sess.compressed:
+		sess.reply("502 compression already active")
+	case len(args) != 1 || strings.ToUpper(args[0]) != "DEFLATE":
+		sess.reply("503 only DEFLATE is supported")
+	default:
+		sess.reply("206 compression active")
+		w, _ := flate.NewWriter(sess.raw, flate.DefaultCompression)
+		sess.conn = textproto.NewConn(&deflated{flate.NewReader(sess.raw), w, sess.raw})
+		sess.compressed = true
+	}
+}
+
+// raw DEFLATE streams in both directions; writes are flushed
+// immediately
+type deflated struct {
+	r   io.ReadCloser
+	w   *flate.Writer
+	raw net.Conn
+}
+
+func (d *deflated) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+func (d *deflated) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if err == nil {
+		err = d.w.Flush()
+	}
+
+	return n, err
+}
+
+func (d *deflated) Close() error {
+	return d.raw.Close()
+}
+
+// AUTHINFO SASL mechanism [initial-response]
+func (sess *session) sasl(args []string) {
+	login, password := sess.auth()
+	mechanism := strings.ToUpper(args[0])
+
+	sess.mu.Lock()
+	offered := false
+	for _, m := range sess.mechanisms {
+		offered = offered || m == mechanism
+	}
+	sess.mu.Unlock()
+
+	if !offered {
+		sess.reply("503 mechanism not available")
+		return
+	}
+
+	accepted := false
+	switch mechanism {
+	case "PLAIN":
+		if len(args) < 2 {
+			sess.reply("482 initial response required")
+			return
+		}
+
+		response, _ := base64.StdEncoding.DecodeString(args[1])
+		accepted = string(response) == "\x00"+login+"\x00"+password
+
+	case "CRAM-MD5":
+		challenge := fmt.Sprintf("<%d.%d@nntptest>", sess.number, len(login))
+		sess.reply("383 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+
+		line, err := sess.conn.ReadLine()
+		if err != nil || line == "*" {
+			sess.reply("481 authentication cancelled")
+			return
+		}
+
+		mac := hmac.New(md5.New, []byte(password))
+		mac.Write([]byte(challenge))
+		response, _ := base64.StdEncoding.DecodeString(line)
+		accepted = string(response) == login+" "+hex.EncodeToString(mac.Sum(nil))
+	}
+
+	if !accepted {
+		sess.reply("481 authentication failed")
+		return
+	}
+
+	sess.authenticated = true
+	sess.reply("281 authentication accepted")
+}
+
+// sorted article numbers of group; must be called with sess.mu
+// held
+func (sess *session) numbers(group string) []int {
+	rv := make([]int, 0, len(sess.groups[group]))
+	for no := range sess.groups[group] {
+		rv = append(rv, no)
+	}
+
+	sort.Ints(rv)
+	return rv
+}
+
+// sorted article numbers and articles of group; a copy, as
+// AddArticle and POST may change the group meanwhile
+func (sess *session) articles(group string) ([]int, map[int]string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	rv := make(map[int]string, len(sess.groups[group]))
+	for no, article := range sess.groups[group] {
+		rv[no] = article
+	}
+
+	return sess.numbers(group), rv
+}
+
+// GROUP or (if list) LISTGROUP
+func (sess *session) selectGroup(args []string, list bool) {
+	group := sess.group
+	if len(args) > 0 {
+		group = args[0]
+	}
+
+	sess.mu.Lock()
+	_, ok := sess.groups[group]
+	numbers := sess.numbers(group)
+	sess.mu.Unlock()
+
+	if !ok {
+		sess.reply("411 no such group")
+		return
+	}
+
+	sess.group = group
+	lo, hi := 0, 0
+	if len(numbers) > 0 {
+		lo, hi = numbers[0], numbers[len(numbers)-1]
+	}
+
+	status := fmt.Sprintf("211 %d %d %d %s", len(numbers), lo, hi, group)
+	if !list {
+		sess.reply("%s", status)
+		return
+	}
+
+	from, to := 0, hi
+	if len(args) > 1 {
+		from, to = parseRange(args[1], hi)
+	}
+
+	lines := make([]string, 0)
+	for _, no := range numbers {
+		if from <= no && no <= to {
+			lines = append(lines, strconv.Itoa(no))
+		}
+	}
+
+	sess.block(status, lines)
+}
+
+// LIST ACTIVE or LIST NEWSGROUPS, with an optional wildmat
+func (sess *session) list(args []string) {
+	keyword, wildmat := "ACTIVE", "*"
+	if len(args) > 0 {
+		keyword = strings.ToUpper(args[0])
+	}
+
+	if len(args) > 1 {
+		wildmat = args[1]
+	}
+
+	sess.mu.Lock()
+	lines := make([]string, 0)
+	for group := range sess.groups {
+		if !matchWildmat(wildmat, group) {
+			continue
+		}
+
+		switch keyword {
+		case "ACTIVE":
+			lines = append(lines, sess.active(group))
+		case "NEWSGROUPS":
+			lines = append(lines, fmt.Sprintf("%s\t%s", group, sess.descriptions[group]))
+		}
+	}
+	sess.mu.Unlock()
+
+	if keyword != "ACTIVE" && keyword != "NEWSGROUPS" {
+		sess.reply("501 unknown LIST keyword")
+		return
+	}
+
+	sort.Strings(lines)
+	sess.block("215 list follows", lines)
+}
+
+// NEWGROUPS date time [GMT]
+func (sess *session) newGroups(args []string) {
+	if len(args) < 2 {
+		sess.reply("501 syntax error")
+		return
+	}
+
+	since, err := time.Parse("20060102 150405", args[0]+" "+args[1])
+	if err != nil {
+		sess.reply("501 bad date")
+		return
+	}
+
+	sess.mu.Lock()
+	lines := make([]string, 0)
+	for group := range sess.groups {
+		if sess.created[group].After(since) {
+			lines = append(lines, sess.active(group))
+		}
+	}
+	sess.mu.Unlock()
+
+	sort.Strings(lines)
+	sess.block("231 list of new newsgroups follows", lines)
+}
+
+// NEWNEWS wildmat date time [GMT]; an article's arrival is taken
+// from its Date header
+func (sess *session) newNews(args []string) {
+	if len(args) < 3 {
+		sess.reply("501 syntax error")
+		return
+	}
+
+	since, err := time.Parse("20060102 150405", args[1]+" "+args[2])
+	if err != nil {
+		sess.reply("501 bad date")
+		return
+	}
+
+	sess.mu.Lock()
+	lines := make([]string, 0)
+	for group, articles := range sess.groups {
+		if !matchWildmat(args[0], group) {
+			continue
+		}
+
+		for _, article := range articles {
+			date, err := mail.ParseDate(header(article, "Date"))
+			if err == nil && date.After(since) {
+				lines = append(lines, header(article, "Message-ID"))
+			}
+		}
+	}
+	sess.mu.Unlock()
+
+	sort.Strings(lines)
+	sess.block("230 list of new articles follows", lines)
+}
+
+// group's line in LIST ACTIVE; must be called with sess.mu held
+func (sess *session) active(group string) string {
+	numbers := sess.numbers(group)
+	lo, hi := 1, 0
+	if len(numbers) > 0 {
+		lo, hi = numbers[0], numbers[len(numbers)-1]
+	}
+
+	return fmt.Sprintf("%s %d %d y", group, hi, lo)
+}
+
+// A simple wildmat (see RFC 3977, 4): comma separated patterns,
+// the last matching one decides; patterns starting with „!“
+// exclude.
+func matchWildmat(wildmat, name string) bool {
+	rv := false
+	for _, pattern := range strings.Split(wildmat, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), name); ok {
+			rv = !negated
+		}
+	}
+
+	return rv
+}
+
+// Parses „n“, „n-“ or „n-m“.
+func parseRange(str string, hi int) (from, to int) {
+	parts := strings.SplitN(str, "-", 2)
+	from, _ = strconv.Atoi(parts[0])
+	to = from
+
+	if len(parts) == 2 {
+		to = hi
+		if parts[1] != "" {
+			to, _ = strconv.Atoi(parts[1])
+		}
+	}
+
+	return
+}
+
+// Finds an article by number (in the current group) or message
+// id. Returns its number (0 if found by message id).
+func (sess *session) find(spec string) (string, int, bool) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if strings.HasPrefix(spec, "<") {
+		for _, articles := range sess.groups {
+			for _, article := range articles {
+				if header(article, "Message-ID") == spec {
+					return article, 0, true
+				}
+			}
+		}
+
+		return "", 0, false
+	}
+
+	no, _ := strconv.Atoi(spec)
+	article, ok := sess.groups[sess.group][no]
+	return article, no, ok
+}
+
+// ARTICLE, HEAD, BODY or STAT
+func (sess *session) article(command string, args []string) {
+	if len(args) == 0 {
+		sess.reply("420 no current article")
+		return
+	}
+
+	if sess.group == "" && !strings.HasPrefix(args[0], "<") {
+		sess.reply("412 no newsgroup selected")
+		return
+	}
+
+	article, no, ok := sess.find(args[0])
+	if !ok && strings.HasPrefix(args[0], "<") {
+		sess.reply("430 no article with that message-id")
+		return
+	}
+
+	if !ok {
+		sess.reply("423 no article with that number")
+		return
+	}
+
+	id := header(article, "Message-ID")
+	head, body := split(article)
+
+	switch command {
+	case "ARTICLE":
+		sess.block(fmt.Sprintf("220 %d %s", no, id), strings.Split(article, "\n"))
+	case "HEAD":
+		sess.block(fmt.Sprintf("221 %d %s", no, id), strings.Split(head, "\n"))
+	case "BODY":
+		sess.block(fmt.Sprintf("222 %d %s", no, id), strings.Split(body, "\n"))
+	case "STAT":
+		sess.reply("223 %d %s", no, id)
+	}
+}
+
+// OVER or XOVER with a range
+func (sess *session) over(args []string) {
+	if sess.group == "" {
+		sess.reply("412 no newsgroup selected")
+		return
+	}
+
+	numbers, articles := sess.articles(sess.group)
+
+	hi := 0
+	if len(numbers) > 0 {
+		hi = numbers[len(numbers)-1]
+	}
+
+	from, to := 0, hi
+	if len(args) > 0 {
+		from, to = parseRange(args[0], hi)
+	}
+
+	lines := make([]string, 0)
+	for _, no := range numbers {
+		if from <= no && no <= to {
+			article := articles[no]
+			_, body := split(article)
+			lines = append(lines, fmt.Sprintf("%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d",
+				no, header(article, "Subject"), header(article, "From"),
+				header(article, "Date"), header(article, "Message-ID"),
+				header(article, "References"), len(article),
+				strings.Count(body, "\n")+1))
+		}
+	}
+
+	if len(lines) == 0 {
+		sess.reply("423 no articles in that range")
+		return
+	}
+
+	sess.block("224 overview information follows", lines)
+}
+
+// HDR or XHDR with a field and a range, or XPAT with a field, a
+// range and wildmat patterns
+func (sess *session) hdr(command string, args []string) {
+	if len(args) < 2 || (command == "XPAT" && len(args) < 3) {
+		sess.reply("501 syntax error")
+		return
+	}
+
+	if sess.group == "" {
+		sess.reply("412 no newsgroup selected")
+		return
+	}
+
+	numbers, articles := sess.articles(sess.group)
+
+	hi := 0
+	if len(numbers) > 0 {
+		hi = numbers[len(numbers)-1]
+	}
+
+	from, to := parseRange(args[1], hi)
+	wildmat := strings.Join(args[2:], ",")
+
+	lines := make([]string, 0)
+	for _, no := range numbers {
+		value := header(articles[no], args[0])
+		if from <= no && no <= to && (command != "XPAT" || matchWildmat(wildmat, value)) {
+			lines = append(lines, fmt.Sprintf("%d %s", no, value))
+		}
+	}
+
+	status := "221 header follows"
+	if command == "HDR" {
+		status = "225 headers follow"
+	}
+
+	sess.block(status, lines)
+}
+
+// POST; the article is added to the groups in its Newsgroups
+// header that we know.
+func (sess *session) post() {
+	sess.reply("340 send article")
+
+	lines, err := sess.conn.ReadDotLines()
+	if err != nil {
+		return
+	}
+
+	article := strings.Join(lines, "\n")
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	sess.posted = append(sess.posted, article)
+	for _, group := range strings.Split(header(article, "Newsgroups"), ",") {
+		group = strings.TrimSpace(group)
+		if articles, ok := sess.groups[group]; ok {
+			numbers := sess.numbers(group)
+			next := 1
+			if len(numbers) > 0 {
+				next = numbers[len(numbers)-1] + 1
+			}
+
+			articles[next] = article
+		}
+	}
+
+	sess.reply("240 article received")
+}
+
+// Separates headers and body.
+func split(article string) (head, body string) {
+	parts := strings.SplitN(article, "\n\n", 2)
+	head = parts[0]
+	if len(parts) == 2 {
+		body = parts[1]
+	}
+
+	return
+}
+
+// Value of the (unfolded) header name in article, or "".
+func header(article, name string) string {
+	head, _ := split(article)
+	for _, line := range strings.Split(head, "\n") {
+		if i := strings.Index(line, ":"); i > 0 && strings.EqualFold(line[:i], name) {
+			return strings.TrimSpace(line[i+1:])
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,259 @@
+package nntp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Articles we wrote are kept in this group of the store (see
+// ArticleStore) until they are posted. Each one is saved as
+// „name“; if the server refused it, the data „.name.error“
+// contains its reply.
+const OUTBOX = "outbox"
+
+// An article waiting in the outbox.
+type OutboxEntry struct {
+	Name  string // in OUTBOX
+	Draft Draft
+	Error string // why posting failed last time (if it did)
+}
+
+// Saves draft in the outbox under name, or under a new name if
+// name is empty. A new draft gets a Message-ID and a Date, so
+// that it can be referred to before it is posted. Returns the
+// name.
+func SaveDraft(store ArticleStore, draft Draft, name string) (string, error) {
+	var err error
+	if draft.Id == "" {
+		draft.Id, err = newMessageId(draft.From)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if draft.Date == "" {
+		draft.Date = time.Now().Format(time.RFC1123Z)
+	}
+
+	if name == "" {
+		// the message id is unique, but contains „@“ and such
+		name = strings.Trim(string(draft.Id), "<>")
+		name = strings.Replace(name, "/", "_", -1)
+	}
+
+	if !validDraftName(name) {
+		return "", fmt.Errorf("invalid draft name %q", name)
+	}
+
+	article, err := draft.Article()
+	if err != nil {
+		return "", err
+	}
+
+	err = store.Put(OUTBOX, name, RawArticle(article))
+	if err != nil {
+		return "", err
+	}
+
+	// edited, so the old error doesn't apply any more
+	store.Delete(OUTBOX, errorName(name))
+	return name, nil
+}
+
+// Reads the draft saved under name.
+func ReadDraft(store ArticleStore, name string) (OutboxEntry, error) {
+	if !validDraftName(name) {
+		return OutboxEntry{}, fmt.Errorf("invalid draft name %q", name)
+	}
+
+	data, err := store.Get(OUTBOX, name)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+
+	reason, _ := store.ReadData(OUTBOX, errorName(name))
+
+	return OutboxEntry{
+		Name:  name,
+		Draft: parseDraft(string(data)),
+		Error: TrimWhite(string(reason)),
+	}, nil
+}
+
+// Lists all drafts in the outbox, sorted by name.
+func ReadOutbox(store ArticleStore) ([]OutboxEntry, error) {
+	names, err := store.List(OUTBOX)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]OutboxEntry, 0, len(names))
+	for _, name := range names {
+		entry, err := ReadDraft(store, name)
+		if err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, entry)
+	}
+
+	return rv, nil
+}
+
+// Removes the draft saved under name.
+func DeleteDraft(store ArticleStore, name string) error {
+	if !validDraftName(name) {
+		return fmt.Errorf("invalid draft name %q", name)
+	}
+
+	store.Delete(OUTBOX, errorName(name))
+	return store.Delete(OUTBOX, name)
+}
+
+// where the server's reply to a refused draft is saved
+func errorName(name string) string {
+	return "." + name + ".error"
+}
+
+// Can name be a draft in the outbox? Names come from the browser,
+// so anything but a plain file name (e. g. „../config.txt“ or
+// „.name.error“) is refused.
+func validDraftName(name string) bool {
+	return name != "" && name == filepath.Base(name) && name[0] != '.' && !strings.HasSuffix(name, ".tmp")
+}
+
+// Posts the draft saved under name. If the server refuses it,
+// its reply is saved along with it; if we couldn't talk to the
+// server, it just stays in the outbox.
+func SendDraft(client *Client, store ArticleStore, name string) error {
+	entry, err := ReadDraft(store, name)
+	if err != nil {
+		return err
+	}
+
+	article, err := entry.Draft.Article()
+	if err != nil {
+		return err
+	}
+
+	err = client.Post(article)
+
+	if _, ok := err.(*Error); ok {
+		store.WriteData(OUTBOX, errorName(name), []byte(err.Error()))
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return DeleteDraft(store, name)
+}
+
+// Posts everything in the outbox. Refused articles stay there
+// (see SendDraft); the first error is returned.
+func FlushOutbox(config map[string]string) error {
+	store := OpenStore(config)
+	entries, err := ReadOutbox(store)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	client, err := connect(config)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	var firstErr error
+	for _, entry := range entries {
+		err = SendDraft(client, store, entry.Name)
+		if _, ok := err.(*Error); !ok && err != nil {
+			return err
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	client.Quit()
+	return firstErr
+}
+
+// Posts the draft saved under name on its own connection.
+func SendDraftNow(config map[string]string, name string) error {
+	client, err := connect(config)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	err = SendDraft(client, OpenStore(config), name)
+	if err != nil {
+		return err
+	}
+
+	client.Quit()
+	return nil
+}
+
+// Inverse of Draft.Article.
+func parseDraft(text string) Draft {
+	decoder := new(mime.WordDecoder)
+	decode := func(header string) string {
+		if decoded, err := decoder.DecodeHeader(header); err == nil {
+			return decoded
+		}
+		return header
+	}
+
+	rawHeaders, body := firstAndRest(text, "\n\n")
+
+	headers := make(map[string]string)
+	for _, line := range strings.Split(rawHeaders, "\n") {
+		key, value := firstAndRest(line, ": ")
+		headers[http.CanonicalHeaderKey(key)] = value
+	}
+
+	return Draft{
+		From:       decode(headers["From"]),
+		Newsgroups: headers["Newsgroups"],
+		Subject:    decode(headers["Subject"]),
+		References: headers["References"],
+		Id:         MessageId(headers["Message-Id"]),
+		Date:       headers["Date"],
+		Body:       body,
+	}
+}
+
+// Generates a unique message id; its right hand side is the
+// domain of from (or „loread.invalid“ if there's none).
+func newMessageId(from string) (MessageId, error) {
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	domain := "loread.invalid"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.TrimRight(from[i+1:], "> \t")
+	}
+
+	id := fmt.Sprintf("<%d.%s@%s>", time.Now().Unix(), hex.EncodeToString(random), domain)
+	return MessageId(id), nil
+}
@@ -0,0 +1,112 @@
+package nntp
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDraft(t *testing.T) {
+	defer inTempDir(t)()
+
+	draft := Draft{From: "me <me@example.org>", Newsgroups: "test.group", Subject: "hello", Body: "body\n"}
+	name, err := SaveDraft(testStore, draft, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := ReadDraft(testStore, name)
+	if err != nil || entry.Draft.Subject != "hello" || !strings.HasSuffix(string(entry.Draft.Id), "@example.org>") {
+		t.Errorf("draft %s read back as %+v (%v)", name, entry, err)
+	}
+
+	if err := DeleteDraft(testStore, name); err != nil || testStore.Has(OUTBOX, name) {
+		t.Errorf("draft %s not deleted (%v)", name, err)
+	}
+}
+
+// Draft names from the browser can't reach anything but drafts.
+func TestDraftNames(t *testing.T) {
+	defer inTempDir(t)()
+
+	ioutil.WriteFile("config.txt", []byte("pass: secret\n"), 0600)
+	testStore.Put("test.group", "5", "Message-ID: <5@test>\n\nbody")
+	testStore.WriteData(OUTBOX, errorName("draft"), []byte("441 refused"))
+
+	for _, name := range []string{"../config.txt", "../test.group/5", "/etc/passwd", "..", ".draft.error", "draft.tmp"} {
+		if _, err := ReadDraft(testStore, name); err == nil {
+			t.Errorf("%q read as a draft", name)
+		}
+
+		if _, err := SaveDraft(testStore, Draft{Body: "evil"}, name); err == nil {
+			t.Errorf("%q saved as a draft", name)
+		}
+
+		if err := DeleteDraft(testStore, name); err == nil {
+			t.Errorf("%q deleted as a draft", name)
+		}
+	}
+
+	s := newState(map[string]string{})
+	if page := get(s, url.Values{"view": {"compose"}, "draft": {"../config.txt"}}); strings.Contains(page, "secret") {
+		t.Errorf("config.txt shown as a draft: %s", page)
+	}
+
+	post(s, "outbox", "http://example.com", url.Values{"remove": {"../config.txt"}})
+	if _, err := os.Stat("config.txt"); err != nil {
+		t.Errorf("config.txt removed as a draft: %s", err)
+	}
+
+	if article, _ := testStore.Get("test.group", "5"); string(article) != "Message-ID: <5@test>\n\nbody" {
+		t.Errorf("article overwritten: %q", article)
+	}
+}
+
+// Only our own compose form can post.
+func TestPostOrigin(t *testing.T) {
+	defer inTempDir(t)()
+
+	s := newState(map[string]string{})
+	form := url.Values{"newsgroups": {"test.group"}, "subject": {"hello"}, "action": {"Save to outbox"}}
+
+	get(s, url.Values{"view": {"post"}, "newsgroups": {"test.group"}, "action": {"Send"}})
+	post(s, "post", "http://evil.example.org", form)
+	post(s, "post", "", form)
+	if entries, _ := ReadOutbox(testStore); len(entries) != 0 {
+		t.Errorf("draft saved from another page: %+v", entries)
+	}
+
+	post(s, "post", "http://example.com", form)
+	if entries, _ := ReadOutbox(testStore); len(entries) != 1 || entries[0].Draft.Subject != "hello" {
+		t.Errorf("draft not saved from the compose form: %+v", entries)
+	}
+}
+
+// Drafts are only removed or sent from the outbox page itself.
+func TestOutboxOrigin(t *testing.T) {
+	defer inTempDir(t)()
+
+	name, err := SaveDraft(testStore, Draft{Newsgroups: "test.group", Subject: "hello"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newState(map[string]string{})
+	get(s, url.Values{"view": {"outbox"}, "remove": {name}})
+	get(s, url.Values{"view": {"outbox"}, "send": {"yes"}})
+	post(s, "outbox", "http://evil.example.org/", url.Values{"remove": {name}})
+	if !testStore.Has(OUTBOX, name) {
+		t.Fatalf("draft removed from another page")
+	}
+
+	if page := get(s, url.Values{"view": {"outbox"}}); !strings.Contains(page, `value="`+name+`"`) {
+		t.Errorf("draft not listed: %s", page)
+	}
+
+	post(s, "outbox", "http://example.com/?view=outbox", url.Values{"remove": {name}})
+	if testStore.Has(OUTBOX, name) {
+		t.Errorf("draft not removed from the outbox page")
+	}
+}
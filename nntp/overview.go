@@ -0,0 +1,171 @@
+package nntp
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const OVERVIEW_FOLLOWS = 224
+
+// One line of overview data as returned by OVER or XOVER (see RFC
+// 3977, 8.3). The headers are not decoded.
+type OverviewRecord struct {
+	Number     int       // article number in its group
+	Subject    string    // Subject header
+	From       string    // From header
+	Date       string    // Date header
+	Id         MessageId // Message-ID header
+	References string    // References header
+	Bytes      int       // size of the article (:bytes)
+	Lines      int       // number of lines of the body (:lines)
+}
+
+// Retrieves the overview records of the articles from..to in the
+// current group. Uses OVER if the server advertises it and XOVER
+// otherwise. A range without articles gives no records (the
+// server replies 423, see RFC 3977, 8.3.2).
+func (c *Client) Overview(from, to int) ([]OverviewRecord, error) {
+	command := "XOVER"
+	if c.caps.Has("OVER") {
+		command = "OVER"
+	}
+
+	_, _, err := c.cmd(OVERVIEW_FOLLOWS, "%s %d-%d", command, from, to)
+	if e, ok := err.(*Error); ok && e.Code == NO_SUCH_NUMBER {
+		return nil, nil // no articles in this range
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := c.conn.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]OverviewRecord, 0, len(lines))
+	for _, line := range lines {
+		if record, ok := parseOverviewLine(line); ok {
+			rv = append(rv, record)
+		}
+	}
+
+	return rv, nil
+}
+
+// Parses one tab separated line of overview data; returns false
+// if it is malformed.
+func parseOverviewLine(line string) (OverviewRecord, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 8 {
+		return OverviewRecord{}, false
+	}
+
+	number, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return OverviewRecord{}, false
+	}
+
+	return OverviewRecord{
+		Number:     number,
+		Subject:    fields[1],
+		From:       fields[2],
+		Date:       fields[3],
+		Id:         MessageId(fields[4]),
+		References: fields[5],
+		Bytes:      atoi(fields[6], 0),
+		Lines:      atoi(fields[7], 0),
+	}, true
+}
+
+// Inverse of parseOverviewLine.
+func (record OverviewRecord) String() string {
+	return fmt.Sprintf("%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d",
+		record.Number, record.Subject, record.From, record.Date,
+		record.Id, record.References, record.Bytes, record.Lines)
+}
+
+// Converts record into a ParsedArticle without body, so it can be
+// threaded like a downloaded article.
+func (record OverviewRecord) Parsed() ParsedArticle {
+	subj, from := record.Subject, record.From
+
+	// see FormatArticle
+	if strings.HasPrefix(subj, "=?") {
+		subj = decodeHeader(subj)
+	}
+
+	if strings.HasPrefix(from, "=?") {
+		from = decodeHeader(from)
+	}
+
+	refs := make([]MessageId, 0)
+	for _, ref := range SplitByWhite(record.References) {
+		if ref != "" {
+			refs = append(refs, MessageId(ref))
+		}
+	}
+
+	return ParsedArticle{
+		References:   refs,
+		Subject:      subj,
+		Id:           record.Id,
+		OtherHeaders: map[string]string{"From": from, "Date": record.Date},
+		Date:         parseDate(record.Date),
+	}
+}
+
+// Reads the overview records from server saved in
+// „group“/.overview, sorted by article number. Returns nothing
+// (and no error) if there's no such file.
+func ReadOverview(store ArticleStore, group, server string) ([]OverviewRecord, error) {
+	data, err := store.ReadData(group, serverFile(".overview", server))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// later records replace earlier ones with the same number
+	byNumber := make(map[int]OverviewRecord)
+	for _, line := range strings.Split(string(data), "\n") {
+		if record, ok := parseOverviewLine(line); ok {
+			byNumber[record.Number] = record
+		}
+	}
+
+	rv := make([]OverviewRecord, 0, len(byNumber))
+	for _, record := range byNumber {
+		rv = append(rv, record)
+	}
+
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Number < rv[j].Number })
+	return rv, nil
+}
+
+// Appends records from server to „group“/.overview.
+func AppendOverview(store ArticleStore, group, server string, records []OverviewRecord) error {
+	return store.AppendData(group, serverFile(".overview", server), formatOverview(records))
+}
+
+// Replaces the overview records from server in „group“/.overview
+// with records.
+func WriteOverview(store ArticleStore, group, server string, records []OverviewRecord) error {
+	return store.WriteData(group, serverFile(".overview", server), formatOverview(records))
+}
+
+// one line per record
+func formatOverview(records []OverviewRecord) []byte {
+	lines := make([]string, len(records))
+	for i, record := range records {
+		lines[i] = record.String() + "\n"
+	}
+
+	return []byte(strings.Join(lines, ""))
+}
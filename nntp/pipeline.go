@@ -0,0 +1,105 @@
+package nntp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NNTP protocol codes for missing articles
+const (
+	NO_SUCH_NUMBER = 423 // no article with that number
+	NO_SUCH_ID     = 430 // no article with that message id
+)
+
+// Is err the server's way of saying that it doesn't have the
+// requested article?
+func IsNoSuchArticle(err error) bool {
+	e, ok := err.(*Error)
+	return ok && (e.Code == NO_SUCH_NUMBER || e.Code == NO_SUCH_ID)
+}
+
+// Sends command (ARTICLE, HEAD or BODY) for every entry of specs
+// (article numbers or message ids) without waiting for the
+// responses, but with at most window commands outstanding. The
+// responses are passed to fn in the order of specs; replies
+// without text, e. g. 423 or 430 for missing articles, are
+// passed as *Error and don't stop the pipeline. If fn returns an
+// error or the connection fails, Pipeline stops and returns this
+// error; the connection shouldn't be used any more in this case.
+func (c *Client) Pipeline(command string, specs []string, window int,
+	fn func(spec string, text string, err error) error) error {
+	expected := map[string]int{
+		"ARTICLE": ARTICLE_FOLLOWS,
+		"HEAD":    HEAD_FOLLOWS,
+		"BODY":    BODY_FOLLOWS,
+	}[command]
+
+	if expected == 0 {
+		return fmt.Errorf("can't pipeline %s", command)
+	}
+
+	if window < 1 {
+		window = 1
+	}
+
+	slots := make(chan bool, window) // one per outstanding command
+	ids := make(chan uint, window)   // textproto's ids of sent commands
+	done := make(chan bool)          // tells the sender to give up
+	var sendErr error
+
+	go func() {
+		defer close(ids)
+		for _, spec := range specs {
+			select {
+			case slots <- true:
+			case <-done:
+				return
+			}
+
+			id, err := c.conn.Cmd("%s %s", command, spec)
+			if err != nil {
+				sendErr = err
+				return
+			}
+
+			ids <- id
+		}
+	}()
+
+	defer close(done)
+
+	i := 0
+	for id := range ids {
+		text, err := c.response(id, expected)
+		<-slots
+
+		if _, ok := err.(*Error); err != nil && !ok {
+			return err
+		}
+
+		err = fn(specs[i], text, err)
+		if err != nil {
+			return err
+		}
+
+		i++
+	}
+
+	// ids is closed, so the sender is done with sendErr
+	return sendErr
+}
+
+// Reads the response to the command with textproto's id id,
+// including its text if the code is expected.
+func (c *Client) response(id uint, expected int) (string, error) {
+	c.conn.intern.StartResponse(id)
+	defer c.conn.intern.EndResponse(id)
+
+	_, _, err := c.conn.ReadCodeLine(expected)
+	if err != nil {
+		return "", err
+	}
+
+	lines, err := c.conn.ReadDotLines()
+	return strings.Join(lines, "\n"), err
+}
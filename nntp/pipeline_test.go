@@ -0,0 +1,109 @@
+package nntp
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// Serves ARTICLE n for odd n and replies 423 for even n. It only
+// starts answering once it has received window commands, so the
+// test hangs if the client doesn't pipeline.
+func pipelineStandIn(ln net.Listener, window int) {
+	raw, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer raw.Close()
+
+	conn := textproto.NewConn(raw)
+	conn.PrintfLine("200 stand-in ready")
+
+	pending := make([]string, 0)
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case line == "CAPABILITIES":
+			conn.PrintfLine("101 capability list follows")
+			conn.PrintfLine("VERSION 2\r\nREADER\r\n.")
+
+		case strings.HasPrefix(line, "ARTICLE "):
+			pending = append(pending, line[len("ARTICLE "):])
+			if len(pending) < window {
+				continue
+			}
+
+			for _, no := range pending {
+				if atoi(no, 0)%2 == 0 {
+					conn.PrintfLine("423 no article with that number")
+				} else {
+					conn.PrintfLine("220 %s <%s@test>", no, no)
+					conn.PrintfLine("Message-ID: <%s@test>\r\n\r\nbody %s\r\n.", no, no)
+				}
+			}
+			pending = pending[:0]
+
+		case line == "QUIT":
+			conn.PrintfLine("205 bye")
+			return
+
+		default:
+			conn.PrintfLine("500 unknown command")
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	const window = 4
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go pipelineStandIn(ln, window)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	client, err := Dial(map[string]string{"server": host, "port": port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Quit()
+
+	specs := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+	i := 0
+	err = client.Pipeline("ARTICLE", specs, window, func(spec, text string, err error) error {
+		if spec != specs[i] {
+			t.Errorf("got response for %s, expected %s", spec, specs[i])
+		}
+		i++
+
+		if atoi(spec, 0)%2 == 0 {
+			if !IsNoSuchArticle(err) {
+				t.Errorf("article %s: expected 423, got %v", spec, err)
+			}
+			return nil
+		}
+
+		if err != nil {
+			t.Errorf("article %s: %s", spec, err)
+		} else if !strings.HasSuffix(text, "body "+spec) {
+			t.Errorf("article %s has wrong text %q", spec, text)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i != len(specs) {
+		t.Errorf("got %d responses instead of %d", i, len(specs))
+	}
+}
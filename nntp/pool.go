@@ -0,0 +1,222 @@
+package nntp
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// NNTP protocol codes a server uses for refusing connections
+const (
+	SERVICE_UNAVAILABLE = 400 // e. g. too many connections
+	SERVICE_REFUSED     = 502 // permanently unavailable for us
+)
+
+// Does err tell us that the server doesn't want more connections?
+func isConnectionLimit(err error) bool {
+	var e *Error
+	return errors.As(err, &e) &&
+		(e.Code == SERVICE_UNAVAILABLE || e.Code == SERVICE_REFUSED)
+}
+
+// Groups with at least twice as many new articles are split
+// into parts fetched on several connections (see fetchParallel).
+const MIN_PART_SIZE = 50
+
+// Something for fetchParallel to do: a group or, once it has been
+// split, a part of it.
+type fetchJob struct {
+	group string
+	fetch *groupFetch // nil for the whole group
+	part  int         // of fetch
+}
+
+// Opens up to „max-connections“ (default 1) connections and
+// fetches groups on them in parallel. The new articles of a large
+// group are split into parts (see groupFetch), so it is fetched on
+// several connections, too. If the server refuses further
+// connections, we make do with those we already have. A
+// connection that breaks (for good, see fetchJobReconnecting) is
+// abandoned and its remaining groups are fetched by the others;
+// other errors only concern their group. Returns the first error.
+func fetchParallel(config map[string]string, store ArticleStore, groups []string) error {
+	maxConnections := atoi(config["max-connections"], 1)
+
+	clients := make([]*Client, 0, maxConnections)
+	for len(clients) < maxConnections || len(clients) == 0 {
+		client, err := connect(config)
+		if err != nil && len(clients) > 0 {
+			if !isConnectionLimit(err) {
+				log.Printf("couldn't open connection %d: %s", len(clients)+1, err)
+			}
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		clients = append(clients, client)
+	}
+
+	// every group is split into at most len(clients) parts, so
+	// adding jobs never blocks
+	jobs := make(chan fetchJob, len(groups)*(len(clients)+1))
+	var pending sync.WaitGroup // jobs not done yet
+	add := func(job fetchJob) {
+		pending.Add(1)
+		jobs <- job
+	}
+
+	for _, g := range groups {
+		add(fetchJob{group: g})
+	}
+
+	go func() {
+		pending.Wait()
+		close(jobs)
+	}()
+
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			defer func() { client.Close() }()
+
+			for job := range jobs {
+				var err error
+				client, err = fetchJobReconnecting(client, store, job, config, len(clients), add)
+				pending.Done()
+
+				// e. g. a group that doesn't exist (any more)
+				// shouldn't keep us from the others
+				if err != nil && !isConnectionError(err) {
+					log.Printf("couldn't fetch %s: %s", job.group, err)
+					setErr(err)
+				} else if err != nil {
+					setErr(err)
+					return
+				}
+			}
+
+			// is allowed to fail
+			client.Quit()
+		}(client)
+	}
+
+	wg.Wait()
+
+	// if every connection failed, nobody is left for these
+	for len(jobs) > 0 {
+		<-jobs
+		pending.Done()
+	}
+
+	return firstErr
+}
+
+// Does job on client: fetches a part of a group, or splits a
+// group into up to n parts which are given to add. If the
+// connection breaks, we reconnect (waiting „retry-delay“, then
+// twice as long etc., at most „retry-limit“ times) and continue
+// where we stopped. Returns the client that is connected now.
+func fetchJobReconnecting(client *Client, store ArticleStore, job fetchJob, config map[string]string, n int,
+	add func(fetchJob)) (*Client, error) {
+	if job.fetch != nil {
+		return reconnecting(client, config, job.group, func(client *Client) error {
+			return job.fetch.fetch(client, config, job.part)
+		})
+	}
+
+	var fetch *groupFetch
+	client, err := reconnecting(client, config, job.group, func(client *Client) error {
+		var err error
+		fetch, err = beginGroup(client, store, job.group, config)
+		return err
+	})
+
+	if err != nil || fetch == nil {
+		return client, err
+	}
+
+	fetch.split(n)
+	if len(fetch.parts) == 0 {
+		return client, fetch.save()
+	}
+
+	for part := range fetch.parts {
+		add(fetchJob{job.group, fetch, part})
+	}
+
+	return client, nil
+}
+
+// Calls fn with client until it succeeds; if the connection
+// breaks while fetching group, we reconnect (see
+// fetchJobReconnecting). fn must continue where it stopped.
+func reconnecting(client *Client, config map[string]string, group string, fn func(*Client) error) (*Client, error) {
+	limit := atoi(config["retry-limit"], 5)
+	delay, err := time.ParseDuration(config["retry-delay"])
+	if err != nil {
+		delay = time.Second
+	}
+
+	retries := 0
+	for {
+		err := fn(client)
+		if err == nil || !isConnectionError(err) {
+			return client, err
+		}
+
+		for {
+			if retries >= limit {
+				return client, err
+			}
+
+			retries++
+			log.Printf("lost connection while fetching %s (%s); retrying in %s", group, err, delay)
+			time.Sleep(delay)
+			delay *= 2
+
+			client.Close()
+			var newClient *Client
+			newClient, err = connect(config)
+			if err == nil {
+				client = newClient
+				break
+			}
+
+			if !isConnectionError(err) {
+				return client, err
+			}
+		}
+	}
+}
+
+// Does err mean that the connection broke (or timed out), so that
+// reconnecting might help?
+func isConnectionError(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == SERVICE_UNAVAILABLE
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,157 @@
+package nntp
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// NNTP protocol codes for POST
+const (
+	ARTICLE_POSTED      = 240
+	SEND_ARTICLE        = 340
+	POSTING_NOT_ALLOWED = 440
+	POSTING_FAILED      = 441
+)
+
+// An article we're about to write, as edited in the compose
+// view.
+type Draft struct {
+	From       string // our name and address, e. g. „Jane <jane@example.org>“
+	Newsgroups string // comma separated
+	Subject    string
+	References string    // space separated message ids
+	Id         MessageId // generated when saved in the outbox
+	Date       string    // likewise
+	Body       string
+}
+
+// Prepares a reply to parent, which we read in group: its
+// Followup-To or Newsgroups header is kept, the subject gets a
+// single „Re: “, the parent's id is added to its references and
+// its text is quoted.
+func ReplyDraft(parent *ParsedArticle, group, from string) Draft {
+	newsgroups := parent.OtherHeaders["Newsgroups"]
+	if followup := parent.OtherHeaders["Followup-To"]; followup != "" && followup != "poster" {
+		newsgroups = followup
+	}
+
+	if newsgroups == "" {
+		newsgroups = group
+	}
+
+	refs := make([]string, 0, len(parent.References)+1)
+	for _, ref := range parent.References {
+		refs = append(refs, string(ref))
+	}
+	refs = append(refs, string(parent.Id))
+
+	quoted := make([]string, 0)
+	quoted = append(quoted, fmt.Sprintf("%s wrote:", parent.OtherHeaders["From"]))
+	for _, line := range strings.Split(parent.Body, "\n") {
+		if strings.HasPrefix(line, ">") {
+			quoted = append(quoted, ">"+line)
+		} else {
+			quoted = append(quoted, "> "+line)
+		}
+	}
+
+	return Draft{
+		From:       from,
+		Newsgroups: newsgroups,
+		Subject:    "Re: " + stripPrefixes(parent.Subject),
+		References: strings.Join(refs, " "),
+		Body:       strings.Join(quoted, "\n") + "\n",
+	}
+}
+
+// Formats draft as an article that can be posted. Subject and
+// the name in From are RFC 2047 encoded if they aren't plain
+// ASCII. A line break in a header would start another header (or
+// the body), so it's an error.
+func (draft Draft) Article() (string, error) {
+	fields := []struct{ name, value string }{
+		{"From", draft.From},
+		{"Newsgroups", draft.Newsgroups},
+		{"Subject", draft.Subject},
+		{"References", draft.References},
+		{"Message-ID", string(draft.Id)},
+		{"Date", draft.Date},
+	}
+
+	for _, field := range fields {
+		if strings.ContainsAny(field.value, "\r\n") {
+			return "", fmt.Errorf("line break in %s: %q", field.name, field.value)
+		}
+	}
+
+	headers := []string{
+		"From: " + encodeFrom(draft.From),
+		"Newsgroups: " + draft.Newsgroups,
+		"Subject: " + mime.QEncoding.Encode("UTF-8", draft.Subject),
+	}
+
+	if draft.References != "" {
+		headers = append(headers, "References: "+draft.References)
+	}
+
+	if draft.Id != "" {
+		headers = append(headers, "Message-ID: "+string(draft.Id))
+	}
+
+	if draft.Date != "" {
+		headers = append(headers, "Date: "+draft.Date)
+	}
+
+	headers = append(headers,
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit")
+
+	body := strings.Replace(draft.Body, "\r\n", "\n", -1)
+	return strings.Join(headers, "\n") + "\n\n" + body, nil
+}
+
+// Encodes the name in „Jäne <jane@example.org>“ (see RFC 2047);
+// the address itself has to stay as it is.
+func encodeFrom(from string) string {
+	i := strings.LastIndex(from, "<")
+	if i < 0 {
+		return from
+	}
+
+	name := strings.TrimSpace(from[:i])
+	if name == "" {
+		return from[i:]
+	}
+
+	return mime.QEncoding.Encode("UTF-8", name) + " " + from[i:]
+}
+
+// Posts article (headers and body, separated by an empty line).
+// A refusal by the server is reported as *Error with code
+// POSTING_NOT_ALLOWED or POSTING_FAILED.
+func (c *Client) Post(article string) error {
+	_, _, err := c.cmd(SEND_ARTICLE, "POST")
+	if err != nil {
+		return err
+	}
+
+	w := c.conn.intern.DotWriter()
+	c.conn.printVerbosely(CODE_OUTPUT)
+	c.conn.printVerbosely("%s\n.\n", article)
+	c.conn.printVerbosely(CODE_RESET)
+
+	_, err = w.Write([]byte(strings.TrimRight(article, "\n") + "\n"))
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = c.conn.ReadCodeLine(ARTICLE_POSTED)
+	return err
+}
@@ -0,0 +1,87 @@
+package nntp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplyDraft(t *testing.T) {
+	parent := ParsedArticle{
+		References: []MessageId{"<a@x>", "<b@x>"},
+		Subject:    "Re: AW: lisp",
+		Id:         "<c@x>",
+		OtherHeaders: map[string]string{
+			"From":       "Jane <jane@example.org>",
+			"Newsgroups": "comp.lang.lisp",
+		},
+		Body: "hello\n> earlier",
+	}
+
+	draft := ReplyDraft(&parent, "comp.lang.lisp", "me <me@example.org>")
+
+	if draft.Subject != "Re: lisp" {
+		t.Errorf("wrong subject %q", draft.Subject)
+	}
+
+	if draft.References != "<a@x> <b@x> <c@x>" {
+		t.Errorf("wrong references %q", draft.References)
+	}
+
+	if draft.Newsgroups != "comp.lang.lisp" {
+		t.Errorf("wrong newsgroups %q", draft.Newsgroups)
+	}
+
+	if !strings.Contains(draft.Body, "> hello\n>> earlier") {
+		t.Errorf("wrongly quoted body %q", draft.Body)
+	}
+
+	parent.OtherHeaders["Followup-To"] = "comp.lang.scheme"
+	if draft := ReplyDraft(&parent, "comp.lang.lisp", ""); draft.Newsgroups != "comp.lang.scheme" {
+		t.Errorf("Followup-To ignored: %q", draft.Newsgroups)
+	}
+}
+
+// Header fields can't smuggle in other headers, and non-ASCII
+// ones are encoded (and decoded again when the draft is read).
+func TestDraftHeaders(t *testing.T) {
+	draft := Draft{From: "me <me@example.org>", Newsgroups: "test.group", Subject: "hello", Body: "body\n"}
+
+	for _, field := range []*string{&draft.From, &draft.Newsgroups, &draft.Subject, &draft.References} {
+		for _, evil := range []string{"x\r\nApproved: yes", "x\nApproved: yes", "x\rApproved: yes"} {
+			old := *field
+			*field = evil
+			if article, err := draft.Article(); err == nil {
+				t.Errorf("line break accepted: %q", article)
+			}
+			*field = old
+		}
+	}
+
+	article, err := draft.Article()
+	if err != nil || !strings.Contains(article, "From: me <me@example.org>\n") || !strings.Contains(article, "Subject: hello\n") {
+		t.Errorf("ASCII headers changed: %q (%v)", article, err)
+	}
+
+	draft.From, draft.Subject = "Jäne Doe <jane@example.org>", "Grüße aus Köln"
+	article, err = draft.Article()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(article[:strings.Index(article, "\n\n")], "\n") {
+		for _, r := range line {
+			if r > 127 {
+				t.Errorf("header %q isn't encoded", line)
+				break
+			}
+		}
+	}
+
+	if !strings.Contains(article, " <jane@example.org>\n") {
+		t.Errorf("address encoded, too: %q", article)
+	}
+
+	if parsed := parseDraft(article); parsed.From != draft.From || parsed.Subject != draft.Subject {
+		t.Errorf("read back as %q, %q", parsed.From, parsed.Subject)
+	}
+}
@@ -0,0 +1,204 @@
+package nntp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// A local SOCKS5 or HTTP CONNECT proxy requiring login and
+// password (if not empty). Returns its URL (for „proxy“) and a
+// channel receiving the address of every connection made.
+func proxyStandIn(t *testing.T, scheme, login, password string) (string, <-chan string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connected := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				var addr string
+				if scheme == PROXY_SOCKS5 {
+					addr = socks5Handshake(r, conn, login, password)
+				} else {
+					addr = httpHandshake(r, conn, login, password)
+				}
+
+				if addr == "" {
+					return
+				}
+
+				target, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+
+				connected <- addr
+				go io.Copy(target, r)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	userinfo := ""
+	if login != "" {
+		userinfo = login + ":" + password + "@"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, userinfo, ln.Addr()), connected, func() { ln.Close() }
+}
+
+// Server side of socks5Connect; returns the requested address or
+// "" if the client is refused.
+func socks5Handshake(r *bufio.Reader, w io.Writer, login, password string) string {
+	header := make([]byte, 2)
+	io.ReadFull(r, header)
+	methods := make([]byte, header[1])
+	io.ReadFull(r, methods)
+
+	if login == "" {
+		w.Write([]byte{SOCKS_VERSION, SOCKS_NO_AUTH})
+	} else {
+		w.Write([]byte{SOCKS_VERSION, SOCKS_PASSWORD_AUTH})
+
+		r.ReadByte() // version
+		n, _ := r.ReadByte()
+		user := make([]byte, n)
+		io.ReadFull(r, user)
+		n, _ = r.ReadByte()
+		pass := make([]byte, n)
+		io.ReadFull(r, pass)
+
+		if string(user) != login || string(pass) != password {
+			w.Write([]byte{SOCKS_PASSWORD_VERSION, 1})
+			return ""
+		}
+
+		w.Write([]byte{SOCKS_PASSWORD_VERSION, SOCKS_PASSWORD_OK})
+	}
+
+	request := make([]byte, 4)
+	io.ReadFull(r, request)
+
+	var host string
+	switch request[3] {
+	case SOCKS_IPV4:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case SOCKS_DOMAIN:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		io.ReadFull(r, name)
+		host = string(name)
+	}
+
+	port := make([]byte, 2)
+	io.ReadFull(r, port)
+
+	// bound to 0.0.0.0:0
+	w.Write([]byte{SOCKS_VERSION, SOCKS_SUCCEEDED, 0, SOCKS_IPV4, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+}
+
+// Server side of httpConnect.
+func httpHandshake(r *bufio.Reader, w io.Writer, login, password string) string {
+	request, err := http.ReadRequest(r)
+	if err != nil || request.Method != http.MethodConnect {
+		return ""
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(login+":"+password))
+	if login != "" && request.Header.Get("Proxy-Authorization") != expected {
+		io.WriteString(w, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return ""
+	}
+
+	io.WriteString(w, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return request.Host
+}
+
+func TestProxy(t *testing.T) {
+	for _, scheme := range []string{PROXY_SOCKS5, PROXY_HTTP} {
+		for _, login := range []string{"", "proxyuser"} {
+			server := newTestServer(t, 1)
+			proxy, connected, stop := proxyStandIn(t, scheme, login, "proxypass")
+
+			config := server.Config()
+			config["proxy"] = proxy
+			client, err := connect(config)
+			if err != nil {
+				t.Errorf("%s: %s", proxy, err)
+			} else if _, _, _, err = client.Group("test.group"); err != nil {
+				t.Errorf("%s: %s", proxy, err)
+			}
+
+			if client != nil {
+				client.Close()
+			}
+
+			if addr := <-connected; addr != net.JoinHostPort(server.Host, server.Port) {
+				t.Errorf("%s: connected to %s", proxy, addr)
+			}
+
+			// wrong password
+			if login != "" {
+				wrong, _ := url.Parse(proxy)
+				wrong.User = url.UserPassword(login, "wrong")
+				config["proxy"] = wrong.String()
+				if client, err = connect(config); err == nil {
+					t.Errorf("%s: wrong proxy password accepted", proxy)
+					client.Close()
+				}
+			}
+
+			stop()
+			server.Close()
+		}
+	}
+}
+
+func TestProxyTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "loread")
+	defer os.RemoveAll(dir)
+	cert, caFile := selfSignedCert(t, dir)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	proxy, connected, stop := proxyStandIn(t, PROXY_SOCKS5, "", "")
+	defer stop()
+
+	config := map[string]string{"tls": TLS_IMPLICIT, "tls-ca-file": caFile, "proxy": proxy}
+	if !dialStandIn(t, config, ln, tlsConf) {
+		t.Errorf("password was sent unencrypted")
+	}
+
+	if addr := <-connected; addr != ln.Addr().String() {
+		t.Errorf("proxy connected to %s", addr)
+	}
+}
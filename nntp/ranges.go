@@ -0,0 +1,146 @@
+package nntp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A set of article numbers, written as in .newsrc files, e. g.
+// „1-5,7,10-12“. The ranges are sorted and don't overlap or touch.
+type Ranges []Range
+
+// The article numbers Lo..Hi (inclusive).
+type Range struct {
+	Lo, Hi int
+}
+
+// Parses the .newsrc notation; malformed parts are ignored.
+func ParseRanges(str string) Ranges {
+	var rv Ranges
+
+	for _, part := range strings.Split(str, ",") {
+		part = TrimWhite(part)
+		lo, hi := firstAndRest(part, "-")
+		if hi == "" {
+			hi = lo
+		}
+
+		from, to := atoi(TrimWhite(lo), -1), atoi(TrimWhite(hi), -1)
+		if from >= 0 && to >= from {
+			rv = append(rv, Range{from, to})
+		}
+	}
+
+	return rv.normalise()
+}
+
+// Inverse of ParseRanges.
+func (r Ranges) String() string {
+	parts := make([]string, len(r))
+	for i, rng := range r {
+		if rng.Lo == rng.Hi {
+			parts[i] = strconv.Itoa(rng.Lo)
+		} else {
+			parts[i] = strconv.Itoa(rng.Lo) + "-" + strconv.Itoa(rng.Hi)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Is no contained in r?
+func (r Ranges) Contains(no int) bool {
+	i := sort.Search(len(r), func(i int) bool { return r[i].Hi >= no })
+	return i < len(r) && r[i].Lo <= no
+}
+
+// How many numbers are contained in r?
+func (r Ranges) Count() int {
+	rv := 0
+	for _, rng := range r {
+		rv += rng.Hi - rng.Lo + 1
+	}
+
+	return rv
+}
+
+// All numbers contained in r in ascending order.
+func (r Ranges) Numbers() []int {
+	rv := make([]int, 0, r.Count())
+	for _, rng := range r {
+		for no := rng.Lo; no <= rng.Hi; no++ {
+			rv = append(rv, no)
+		}
+	}
+
+	return rv
+}
+
+// Adds lo..hi to r.
+func (r *Ranges) AddRange(lo, hi int) {
+	if lo <= hi {
+		*r = append(*r, Range{lo, hi}).normalise()
+	}
+}
+
+// Adds no to r.
+func (r *Ranges) Add(no int) {
+	r.AddRange(no, no)
+}
+
+// Removes no from r.
+func (r *Ranges) Remove(no int) {
+	var rv Ranges
+	for _, rng := range *r {
+		if rng.Lo <= no && no <= rng.Hi {
+			if rng.Lo < no {
+				rv = append(rv, Range{rng.Lo, no - 1})
+			}
+
+			if no < rng.Hi {
+				rv = append(rv, Range{no + 1, rng.Hi})
+			}
+		} else {
+			rv = append(rv, rng)
+		}
+	}
+
+	*r = rv
+}
+
+// Removes all numbers smaller than no from r.
+func (r *Ranges) RemoveBelow(no int) {
+	var rv Ranges
+	for _, rng := range *r {
+		if rng.Hi < no {
+			continue
+		}
+
+		if rng.Lo < no {
+			rng.Lo = no
+		}
+
+		rv = append(rv, rng)
+	}
+
+	*r = rv
+}
+
+// Sorts r and merges overlapping or adjacent ranges.
+func (r Ranges) normalise() Ranges {
+	sort.Slice(r, func(i, j int) bool { return r[i].Lo < r[j].Lo })
+
+	var rv Ranges
+	for _, rng := range r {
+		if last := len(rv) - 1; last >= 0 && rng.Lo <= rv[last].Hi+1 {
+			if rng.Hi > rv[last].Hi {
+				rv[last].Hi = rng.Hi
+			}
+		} else {
+			rv = append(rv, rng)
+		}
+	}
+
+	return rv
+}
@@ -0,0 +1,41 @@
+package nntp
+
+import "testing"
+
+func TestRanges(t *testing.T) {
+	r := ParseRanges("10-12, 1-5,7,4-6,x,9-8")
+
+	if s := r.String(); s != "1-7,10-12" {
+		t.Errorf("ParseRanges gives %s instead of 1-7,10-12", s)
+	}
+
+	if !r.Contains(6) || r.Contains(8) || r.Contains(13) {
+		t.Errorf("Contains is wrong for %s", r)
+	}
+
+	r.Add(8)
+	r.Add(9)
+	if s := r.String(); s != "1-12" {
+		t.Errorf("Add gives %s instead of 1-12", s)
+	}
+
+	r.Remove(1)
+	r.Remove(5)
+	r.Remove(12)
+	if s := r.String(); s != "2-4,6-11" {
+		t.Errorf("Remove gives %s instead of 2-4,6-11", s)
+	}
+
+	r.RemoveBelow(4)
+	if s := r.String(); s != "4,6-11" {
+		t.Errorf("RemoveBelow gives %s instead of 4,6-11", s)
+	}
+
+	if c := r.Count(); c != 7 {
+		t.Errorf("Count gives %d instead of 7", c)
+	}
+
+	if n := r.Numbers(); len(n) != 7 || n[0] != 4 || n[6] != 11 {
+		t.Errorf("Numbers gives %v", n)
+	}
+}
@@ -0,0 +1,245 @@
+package nntp
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Data in which a group's read articles (see ReadState) and the
+// Message-IDs of its starred articles are kept.
+const (
+	READ_STATE = ".read"
+	STARRED    = ".starred"
+)
+
+// Which articles of a group have been read: their numbers from
+// every server (see Servers), as in .newsrc files, and the
+// Message-IDs of articles read in another group they were
+// crossposted to.
+type ReadState struct {
+	Numbers map[string]Ranges // by server
+	Ids     map[MessageId]bool
+}
+
+// Reads the read state of group. The data looks like
+//
+//	1-120,125
+//	paid: 1-40
+//	<crossposted@example.org>
+//
+// where the line without a section name is for a configuration
+// without sections.
+func GetReadState(store ArticleStore, group string) (ReadState, error) {
+	rv := ReadState{make(map[string]Ranges), make(map[MessageId]bool)}
+
+	data, err := store.ReadData(group, READ_STATE)
+	if os.IsNotExist(err) {
+		return rv, nil
+	}
+
+	if err != nil {
+		return rv, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = TrimWhite(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "<"):
+			rv.Ids[MessageId(line)] = true
+		case strings.Contains(line, ":"):
+			server, ranges := firstAndRest(line, ":")
+			rv.Numbers[TrimWhite(server)] = ParseRanges(ranges)
+		default:
+			rv.Numbers[""] = ParseRanges(line)
+		}
+	}
+
+	return rv, nil
+}
+
+// See GetReadState.
+func SetReadState(store ArticleStore, group string, state ReadState) error {
+	servers := make([]string, 0, len(state.Numbers))
+	for server := range state.Numbers {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+
+	lines := make([]string, 0)
+	for _, server := range servers {
+		if server == "" {
+			lines = append(lines, state.Numbers[server].String())
+		} else {
+			lines = append(lines, server+": "+state.Numbers[server].String())
+		}
+	}
+
+	ids := make([]string, 0, len(state.Ids))
+	for id := range state.Ids {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	lines = append(lines, ids...)
+	return store.WriteData(group, READ_STATE, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// Has article no from server (or, if known, the article with
+// Message-ID id) been read?
+func (r ReadState) IsRead(server string, no int, id MessageId) bool {
+	return r.Numbers[server].Contains(no) || (id != "" && r.Ids[id])
+}
+
+// Marks the article saved under name (see ArticleName) in group
+// as read. If it was crossposted to other subscribed groups, it
+// counts as read there, too: by its number from the Xref header
+// and by its Message-ID (for copies from other servers).
+func MarkRead(store ArticleStore, group, name string, article *ParsedArticle, subscribed []string) error {
+	no, server := splitArticleName(name)
+	state, err := GetReadState(store, group)
+	if err != nil {
+		return err
+	}
+
+	if no >= 0 {
+		numbers := state.Numbers[server]
+		numbers.Add(no)
+		state.Numbers[server] = numbers
+	}
+
+	err = SetReadState(store, group, state)
+	if err != nil {
+		return err
+	}
+
+	xref := parseXref(article.OtherHeaders["Xref"])
+	for _, other := range strings.Split(article.OtherHeaders["Newsgroups"], ",") {
+		other = TrimWhite(other)
+		if other == group || !contains(subscribed, other) {
+			continue
+		}
+
+		state, err := GetReadState(store, other)
+		if err != nil {
+			return err
+		}
+
+		if n, ok := xref[other]; ok {
+			numbers := state.Numbers[server]
+			numbers.Add(n)
+			state.Numbers[server] = numbers
+		}
+
+		state.Ids[article.Id] = true
+		err = SetReadState(store, other, state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// How many articles of group haven't been read yet? This includes
+// those we only know from their overview data.
+func CountUnread(config map[string]string, store ArticleStore, group string) (int, error) {
+	state, err := GetReadState(store, group)
+	if err != nil {
+		return 0, err
+	}
+
+	names, err := store.List(group)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// (Message-IDs would mean reading every article)
+	rv := 0
+	saved := make(map[string]bool, len(names))
+	for _, name := range names {
+		saved[name] = true
+		if no, server := splitArticleName(name); !state.IsRead(server, no, "") {
+			rv++
+		}
+	}
+
+	// maybe from several servers
+	seen := make(map[MessageId]bool)
+	for _, server := range Servers(config) {
+		records, err := ReadOverview(store, group, server["section"])
+		if err != nil {
+			return 0, err
+		}
+
+		for _, record := range records {
+			if !saved[ArticleName(record.Number, server["section"])] && !seen[record.Id] &&
+				!state.IsRead(server["section"], record.Number, record.Id) {
+				rv++
+			}
+
+			seen[record.Id] = true
+		}
+	}
+
+	return rv, nil
+}
+
+// The Message-IDs of the starred articles of group, which expiry
+// may spare (see RetentionPolicy).
+func GetStarred(store ArticleStore, group string) (map[MessageId]bool, error) {
+	rv := make(map[MessageId]bool)
+	data, err := store.ReadData(group, STARRED)
+	if os.IsNotExist(err) {
+		return rv, nil
+	}
+
+	for _, id := range strings.Fields(string(data)) {
+		rv[MessageId(id)] = true
+	}
+
+	return rv, err
+}
+
+// See GetStarred.
+func SetStarred(store ArticleStore, group string, starred map[MessageId]bool) error {
+	ids := make([]string, 0, len(starred))
+	for id, ok := range starred {
+		if ok {
+			ids = append(ids, string(id))
+		}
+	}
+	sort.Strings(ids)
+
+	return store.WriteData(group, STARRED, []byte(strings.Join(ids, "\n")+"\n"))
+}
+
+// Parses an Xref header like „news.example.com comp.lang.go:123
+// comp.lang.lisp:456“ into the article numbers by group.
+func parseXref(xref string) map[string]int {
+	rv := make(map[string]int)
+	for _, field := range SplitByWhite(xref) {
+		group, no := firstAndRest(field, ":")
+		if n := atoi(no, -1); no != "" && n >= 0 {
+			rv[group] = n
+		}
+	}
+
+	return rv
+}
+
+// Is str one of strs?
+func contains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package nntp
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadState(t *testing.T) {
+	defer inTempDir(t)()
+
+	state := ReadState{
+		Numbers: map[string]Ranges{"": ParseRanges("1-5,7"), "paid": ParseRanges("3")},
+		Ids:     map[MessageId]bool{"<x@test>": true},
+	}
+
+	if err := SetReadState(testStore, "test.group", state); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := GetReadState(testStore, "test.group")
+	if err != nil || !reflect.DeepEqual(read, state) {
+		t.Errorf("read state %+v is read back as %+v (%v)", state, read, err)
+	}
+
+	if !read.IsRead("", 4, "") || read.IsRead("", 6, "") || read.IsRead("paid", 4, "") || !read.IsRead("paid", 9, "<x@test>") {
+		t.Errorf("wrong read state %+v", read)
+	}
+}
+
+// Reading an article keeps it, marks it as read and marks its
+// crossposts.
+func TestMarkRead(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+	server.AddArticle("other.group", 1, "Message-ID: <other@test>\n\nbody")
+	server.AddArticle("other.group", 2, "Subject: crossposted\nNewsgroups: test.group,other.group\n"+
+		"Xref: test test.group:4 other.group:2\nMessage-ID: <4@test>\n\nbody")
+	server.AddArticle("test.group", 4, "Subject: crossposted\nNewsgroups: test.group,other.group\n"+
+		"Xref: test test.group:4 other.group:2\nMessage-ID: <4@test>\n\nbody")
+
+	config := server.Config()
+	config["groups"] = "test.group, other.group"
+	if err := FetchArticles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newState(config)
+	if page := get(s, url.Values{}); !strings.Contains(page, "4 unread") || !strings.Contains(page, "2 unread") {
+		t.Errorf("wrong unread counts: %s", page)
+	}
+
+	get(s, url.Values{"view": {"group"}, "arg": {"test.group"}})
+	get(s, url.Values{"view": {"article"}, "arg": {"<1@test>"}})
+	get(s, url.Values{"view": {"article"}, "arg": {"<4@test>"}})
+
+	if n, _ := CountUnread(config, testStore, "test.group"); n != 2 {
+		t.Errorf("%d unread articles in test.group instead of 2", n)
+	}
+
+	if n, _ := CountUnread(config, testStore, "other.group"); n != 1 {
+		t.Errorf("crosspost not marked as read in other.group (%d unread)", n)
+	}
+
+	if !testStore.Has("test.group", "1") {
+		t.Errorf("reading deleted the article")
+	}
+
+	// still known after a restart
+	if page := get(newState(config), url.Values{}); !strings.Contains(page, "2 unread") {
+		t.Errorf("read state lost: %s", page)
+	}
+}
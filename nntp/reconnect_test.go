@@ -0,0 +1,41 @@
+package nntp
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestReconnect(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 10)
+	defer server.Close()
+
+	// drop the first connection when article 6 is requested
+	server.SetFault(func(connection int, line string) (string, bool) {
+		return "", connection == 1 && line == "ARTICLE 6"
+	})
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	config["retry-delay"] = "10ms"
+
+	err := FetchArticles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := server.Connections(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+
+	for no := 1; no <= 10; no++ {
+		if !testStore.Has("test.group", strconv.Itoa(no)) {
+			t.Errorf("article %d is missing", no)
+		}
+	}
+
+	if w := testStore.Watermark("test.group", ""); w != 10 {
+		t.Errorf("watermark is %d instead of 10", w)
+	}
+}
@@ -0,0 +1,107 @@
+package nntp
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// NNTP protocol codes for AUTHINFO SASL (see RFC 4643, 2.4)
+const (
+	AUTHEN_ACCEPTED_WITH_DATA = 283
+	SASL_CONTINUE             = 383
+)
+
+// Authentication mechanisms for Login; USER means AUTHINFO
+// USER/PASS.
+const (
+	AUTH_CRAM_MD5 = "CRAM-MD5"
+	AUTH_PLAIN    = "PLAIN"
+	AUTH_USER     = "USER"
+)
+
+// default for the „auth-mechanisms“ key: CRAM-MD5 doesn't send the
+// password, PLAIN at least does it in one piece
+var DEFAULT_MECHANISMS = []string{AUTH_CRAM_MD5, AUTH_PLAIN, AUTH_USER}
+
+// Authenticates with the first of mechanisms that the server
+// advertises in its CAPABILITIES. Servers without CAPABILITIES
+// only get AUTHINFO USER.
+func (c *Client) Login(username, password string, mechanisms []string) error {
+	for _, mechanism := range mechanisms {
+		mechanism = strings.ToUpper(mechanism)
+
+		switch {
+		case mechanism == AUTH_USER && (c.caps == nil || c.caps.HasArgument("AUTHINFO", "USER")):
+			return c.Authenticate(username, password)
+
+		case c.caps.HasArgument("SASL", mechanism) && c.caps.HasArgument("AUTHINFO", "SASL"):
+			return c.AuthenticateSASL(mechanism, username, password)
+		}
+	}
+
+	return fmt.Errorf("none of the authentication mechanisms %s is supported by the server",
+		strings.Join(mechanisms, ", "))
+}
+
+// Sends AUTHINFO SASL with mechanism (AUTH_PLAIN or
+// AUTH_CRAM_MD5).
+func (c *Client) AuthenticateSASL(mechanism, username, password string) error {
+	var code int
+	var message string
+	var err error
+
+	switch mechanism {
+	case AUTH_PLAIN:
+		// initial response: authorisation identity (empty),
+		// authentication identity and password
+		response := "\x00" + username + "\x00" + password
+		code, message, err = c.cmd(0, "AUTHINFO SASL PLAIN %s", encodeSASL(response))
+
+	case AUTH_CRAM_MD5:
+		code, message, err = c.cmd(0, "AUTHINFO SASL CRAM-MD5")
+		if err == nil && code == SASL_CONTINUE {
+			challenge, err := base64.StdEncoding.DecodeString(message)
+			if err != nil {
+				c.cmd(0, "*") // cancel
+				return fmt.Errorf("malformed CRAM-MD5 challenge %s (%w)", message, err)
+			}
+
+			mac := hmac.New(md5.New, []byte(password))
+			mac.Write(challenge)
+			response := username + " " + hex.EncodeToString(mac.Sum(nil))
+			code, message, err = c.cmd(0, "%s", encodeSASL(response))
+		}
+
+	default:
+		return fmt.Errorf("unknown SASL mechanism %s", mechanism)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// we don't know what else the server wants
+	if code == SASL_CONTINUE {
+		c.cmd(0, "*")
+	}
+
+	if code != AUTHEN_ACCEPTED && code != AUTHEN_ACCEPTED_WITH_DATA {
+		return &Error{code, message}
+	}
+
+	// capabilities may change after authentication
+	return c.refreshCapabilities()
+}
+
+// RFC 4643 uses „=“ for an empty initial response.
+func encodeSASL(response string) string {
+	if response == "" {
+		return "="
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(response))
+}
@@ -0,0 +1,55 @@
+package nntp
+
+import (
+	"testing"
+)
+
+func TestSASL(t *testing.T) {
+	for _, mechanism := range []string{AUTH_PLAIN, AUTH_CRAM_MD5} {
+		server := newTestServer(t, 1)
+		defer server.Close()
+		server.SetAuth("user", "secret")
+		server.SetSASL(mechanism)
+
+		config := server.Config()
+		client, err := connect(config)
+		if err != nil {
+			t.Errorf("%s: %s", mechanism, err)
+			continue
+		}
+
+		if _, _, _, err = client.Group("test.group"); err != nil {
+			t.Errorf("%s: not authenticated (%s)", mechanism, err)
+		}
+		client.Close()
+
+		config["pass"] = "wrong"
+		if client, err = connect(config); err == nil {
+			t.Errorf("%s: wrong password accepted", mechanism)
+			client.Close()
+		}
+
+		// AUTHINFO USER is still there, but we don't want it
+		config["pass"] = "secret"
+		config["auth-mechanisms"] = "DIGEST-MD5"
+		if client, err = connect(config); err == nil {
+			t.Errorf("%s: unsupported mechanism used", mechanism)
+			client.Close()
+		}
+	}
+}
+
+func TestAnonymous(t *testing.T) {
+	server := newTestServer(t, 1)
+	defer server.Close()
+
+	client, err := connect(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, _, _, err = client.Group("test.group"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,171 @@
+package nntp
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NNTP protocol codes for HDR (see RFC 3977, 8.5) and the older
+// XHDR and XPAT (see RFC 2980, 2.6 and 2.9)
+const (
+	HEADERS_FOLLOW   = 225
+	XHDR_XPAT_FOLLOW = 221
+)
+
+// how many results Search returns at most
+const MAX_SEARCH_RESULTS = 500
+
+// Header fields that can be searched for.
+var SEARCH_FIELDS = []string{"Subject", "From", "Message-ID"}
+
+// An article found by Search.
+type SearchResult struct {
+	Number int
+	Value  string // of the header field
+}
+
+// The values of field for the articles from from to to in the
+// selected group. Uses HDR if the server offers it, otherwise
+// XHDR.
+func (c *Client) Hdr(field string, from, to int) ([]SearchResult, error) {
+	command, expected := "XHDR", XHDR_XPAT_FOLLOW
+	if c.caps.Has("HDR") {
+		command, expected = "HDR", HEADERS_FOLLOW
+	}
+
+	lines, err := c.list(expected, "%s %s %d-%d", command, field, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSearchResults(lines), nil
+}
+
+// The articles from from to to in the selected group whose field
+// matches one of the wildmat patterns (see RFC 2980, 2.9).
+func (c *Client) XPat(field string, from, to int, patterns ...string) ([]SearchResult, error) {
+	lines, err := c.list(XHDR_XPAT_FOLLOW, "XPAT %s %d-%d %s", field, from, to,
+		strings.Join(patterns, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSearchResults(lines), nil
+}
+
+// lines look like „4711 Re: Lisp is great“
+func parseSearchResults(lines []string) []SearchResult {
+	rv := make([]SearchResult, 0, len(lines))
+	for _, line := range lines {
+		number, value := firstAndRest(line, " ")
+		if no := atoi(number, -1); no >= 0 {
+			rv = append(rv, SearchResult{no, value})
+		}
+	}
+
+	return rv
+}
+
+// Searches all articles the server has in group for those whose
+// field contains text (ignoring case, if the server allows it). If
+// the server doesn't support XPAT, we get all values with HDR and
+// search ourselves. At most MAX_SEARCH_RESULTS (the newest) are
+// returned.
+func (c *Client) Search(group, field, text string) ([]SearchResult, error) {
+	// would end the command (see Conn.Cmd)
+	if strings.IndexFunc(text, func(r rune) bool { return r != '\t' && unicode.IsControl(r) }) >= 0 {
+		return nil, fmt.Errorf("control characters in search text %q", text)
+	}
+
+	_, lo, hi, err := c.Group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	if hi < lo {
+		return nil, nil
+	}
+
+	// wildmats have no escapes, so this doesn't find everything
+	text = strings.Map(func(r rune) rune {
+		if strings.ContainsRune("*?,!", r) || r == ' ' || r == '\t' {
+			return '?'
+		}
+		return r
+	}, text)
+	pattern := "*" + text + "*"
+
+	results, err := c.XPat(field, lo, hi, pattern)
+	if _, refused := err.(*Error); refused {
+		results, err = c.Hdr(field, lo, hi)
+		if err == nil {
+			results = filterResults(results, pattern)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't search %s in %s (%w)", field, group, err)
+	}
+
+	if len(results) > MAX_SEARCH_RESULTS {
+		results = results[len(results)-MAX_SEARCH_RESULTS:]
+	}
+
+	return results, nil
+}
+
+// Those results matching pattern (ignoring case).
+func filterResults(results []SearchResult, pattern string) []SearchResult {
+	pattern = strings.ToLower(pattern)
+	rv := make([]SearchResult, 0)
+	for _, result := range results {
+		if MatchWildmat(pattern, strings.ToLower(result.Value)) {
+			rv = append(rv, result)
+		}
+	}
+
+	return rv
+}
+
+// The server (see Servers) to search group on: the one from
+// section name, or else the first one group is subscribed on.
+// Returns nil for an unknown name.
+func searchServer(config map[string]string, group, name string) map[string]string {
+	servers := Servers(config)
+	for _, server := range servers {
+		if name != "" && server["section"] == name {
+			return server
+		}
+	}
+
+	if name != "" {
+		return nil
+	}
+
+	for _, server := range servers {
+		if groups, err := SubscribedGroups(server); err == nil && contains(groups, group) {
+			return server
+		}
+	}
+
+	return servers[0]
+}
+
+// Like Client.Search, but on its own connection.
+func SearchGroup(config map[string]string, group, field, text string) ([]SearchResult, error) {
+	client, err := connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	defer client.Close()
+
+	results, err := client.Search(group, field, text)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Quit()
+	return results, nil
+}
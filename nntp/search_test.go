@@ -0,0 +1,182 @@
+package nntp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kedorlaomer/loread/nntp/nntptest"
+)
+
+func TestSearch(t *testing.T) {
+	for _, xpat := range []bool{true, false} {
+		func() {
+			defer inTempDir(t)()
+
+			server := newTestServer(t, 12)
+			defer server.Close()
+
+			if !xpat {
+				server.SetFault(func(connection int, line string) (string, bool) {
+					if strings.HasPrefix(line, "XPAT") {
+						return "500 unknown command", false
+					}
+					return "", false
+				})
+			}
+
+			config := server.Config()
+			config["groups"] = "test.group"
+			results, err := SearchGroup(config, "test.group", "Subject", "article 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// article 1, 10, 11, 12
+			if len(results) != 4 || results[0].Number != 1 || results[0].Value != "article 1" {
+				t.Errorf("XPAT %v: found %+v", xpat, results)
+			}
+
+			// fetching a result; only from the search page itself
+			s := newState(config)
+			form := url.Values{"group": {"test.group"}, "field": {"Subject"}, "text": {"article 11"}, "fetch": {"11"}}
+			get(s, url.Values{"view": {"search"}, "group": {"test.group"}, "fetch": {"11"}})
+			post(s, "search", "http://evil.example.org", form)
+			if testStore.Has("test.group", "11") {
+				t.Errorf("XPAT %v: result fetched from another page", xpat)
+			}
+
+			page := post(s, "search", "http://example.com", form)
+			if !testStore.Has("test.group", "11") {
+				t.Errorf("XPAT %v: result wasn't fetched", xpat)
+			}
+
+			if !strings.Contains(page, "article 11") {
+				t.Errorf("XPAT %v: result page doesn't show result: %s", xpat, page)
+			}
+		}()
+	}
+}
+
+// Only known groups can be searched or fetched into.
+func TestSearchGroups(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	s := newState(config)
+	for _, group := range []string{"../../tmp/x", "test.group\r\nQUIT", "other.group"} {
+		page := post(s, "search", "http://example.com", url.Values{"group": {group}, "text": {"article"}, "fetch": {"1"}})
+		if !strings.Contains(page, "unknown group") {
+			t.Errorf("%q searched: %s", group, page)
+		}
+	}
+
+	if groups, _ := testStore.Groups(); len(groups) != 0 {
+		t.Errorf("saved something in %v", groups)
+	}
+}
+
+// A search text can't smuggle in other commands.
+func TestSearchInjection(t *testing.T) {
+	server := newTestServer(t, 3)
+	defer server.Close()
+	commands := recordCommands(server)
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	s := newState(config)
+	for _, text := range []string{"x\r\nPOST", "x\nPOST", "x\rPOST"} {
+		page := get(s, url.Values{"view": {"search"}, "group": {"test.group"}, "text": {text}})
+		if !strings.Contains(page, "control characters") {
+			t.Errorf("%q searched: %s", text, page)
+		}
+	}
+
+	// the same for every command
+	client, err := connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, _, _, err := client.Group("test.group\r\nPOST"); err == nil {
+		t.Errorf("line break sent")
+	}
+
+	for _, command := range commands() {
+		if command == "POST" || strings.HasPrefix(command, "XPAT") {
+			t.Errorf("%q sent", command)
+		}
+	}
+}
+
+// Groups only the second server carries are searched there.
+func TestSearchServers(t *testing.T) {
+	defer inTempDir(t)()
+
+	first := newTestServer(t, 3)
+	defer first.Close()
+
+	second, err := nntptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.AddArticle("other.group", 7, "Subject: elsewhere\nMessage-ID: <7@other>\n\nbody")
+
+	config := map[string]string{"sections": "first, second", "first/groups": "test.group", "second/groups": "other.group"}
+	for section, server := range map[string]*nntptest.Server{"first": first, "second": second} {
+		for key, value := range server.Config() {
+			config[section+"/"+key] = value
+		}
+	}
+
+	s := newState(config)
+	page := get(s, url.Values{"view": {"search"}, "group": {"other.group"}, "text": {"elsewhere"}})
+	if !strings.Contains(page, "7: elsewhere") {
+		t.Errorf("other.group not searched on the second server: %s", page)
+	}
+
+	post(s, "search", "http://example.com", url.Values{"group": {"other.group"}, "text": {"elsewhere"}, "fetch": {"7"}})
+	if !testStore.Has("other.group", "7.second") {
+		t.Errorf("result not fetched from the second server")
+	}
+
+	page = get(s, url.Values{"view": {"search"}, "group": {"other.group"}, "text": {"elsewhere"}, "server": {"first"}})
+	if strings.Contains(page, "7: elsewhere") {
+		t.Errorf("explicitly chosen server ignored: %s", page)
+	}
+}
+
+// Articles may arrive at the test server while it answers (run
+// with -race).
+func TestSearchWhileAdding(t *testing.T) {
+	server := newTestServer(t, 3)
+	defer server.Close()
+
+	stop := make(chan bool)
+	go func() {
+		for no := 4; no < 1000; no++ {
+			select {
+			case <-stop:
+				return
+			default:
+				server.AddArticle("test.group", no, "Subject: more\nMessage-ID: <more@test>\n\nbody")
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+	defer close(stop)
+
+	config := server.Config()
+	for i := 0; i < 5; i++ {
+		if _, err := SearchGroup(config, "test.group", "Subject", "article"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
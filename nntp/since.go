@@ -0,0 +1,86 @@
+package nntp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NNTP protocol code for NEWNEWS
+const NEW_ARTICLES_FOLLOW = 230
+
+// The Message-IDs of the articles in the groups matching wildmat
+// that arrived at the server since the given time.
+func (c *Client) NewNews(wildmat string, since time.Time) ([]MessageId, error) {
+	lines, err := c.list(NEW_ARTICLES_FOLLOW, "NEWNEWS %s %s GMT", wildmat,
+		since.UTC().Format("20060102 150405"))
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]MessageId, 0, len(lines))
+	for _, line := range lines {
+		if line = TrimWhite(line); line != "" {
+			rv = append(rv, MessageId(line))
+		}
+	}
+
+	return rv, nil
+}
+
+// How many of the newest articles of group (which must be
+// selected) are younger than age (see ParseAge), but at most
+// fetchMaximum? Uses NEWNEWS if the server offers it, otherwise
+// the dates from the overview data of the newest fetchMaximum
+// articles.
+func limitSince(client *Client, group, age string, lo, hi, fetchMaximum int) (int, error) {
+	duration, err := ParseAge(age)
+	if err != nil {
+		return 0, fmt.Errorf("malformed fetch-since %s (%w)", age, err)
+	}
+
+	since := time.Now().Add(-duration)
+	count := -1
+
+	// servers often disable NEWNEWS, since it's expensive for them
+	if client.caps == nil || client.caps.Has("NEWNEWS") {
+		ids, err := client.NewNews(group, since)
+		if _, refused := err.(*Error); err != nil && !refused {
+			return 0, err
+		}
+
+		// article numbers are given in order of arrival, so these
+		// are the newest ones
+		if err == nil {
+			count = len(ids)
+		}
+	}
+
+	if count < 0 {
+		from := hi - fetchMaximum + 1
+		if from < lo {
+			from = lo
+		}
+
+		count = 0
+		if from <= hi {
+			records, err := client.Overview(from, hi)
+			if err != nil {
+				return 0, fmt.Errorf("couldn't get overview of %s (%w)", group, err)
+			}
+
+			for _, record := range records {
+				date := parseDate(strings.TrimSpace(record.Date))
+				if date.IsZero() || !date.Before(since) {
+					count++
+				}
+			}
+		}
+	}
+
+	if count < fetchMaximum {
+		return count, nil
+	}
+
+	return fetchMaximum, nil
+}
@@ -0,0 +1,80 @@
+package nntp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kedorlaomer/loread/nntp/nntptest"
+)
+
+func TestFetchSince(t *testing.T) {
+	for _, newnews := range []bool{true, false} {
+		func() {
+			defer inTempDir(t)()
+
+			server, err := nntptest.NewServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+
+			// article no is 10-no and a half days old
+			for no := 1; no <= 10; no++ {
+				date := time.Now().Add(-time.Duration(10-no)*24*time.Hour - 12*time.Hour)
+				server.AddArticle("test.group", no, fmt.Sprintf(
+					"Subject: article %d\nDate: %s\nMessage-ID: <%d@test>\n\nbody of %d",
+					no, date.Format(time.RFC1123Z), no, no))
+			}
+
+			if !newnews {
+				server.SetFault(func(connection int, line string) (string, bool) {
+					if strings.HasPrefix(line, "NEWNEWS") {
+						return "502 NEWNEWS disabled", false
+					}
+					return "", false
+				})
+			}
+
+			config := server.Config()
+			config["groups"] = "test.group"
+			config["fetch-since"] = "3d"
+			if err = FetchArticles(config); err != nil {
+				t.Fatal(err)
+			}
+
+			for no := 1; no <= 10; no++ {
+				if testStore.Has("test.group", strconv.Itoa(no)) != (no >= 8) {
+					t.Errorf("NEWNEWS %v: article %d wrongly fetched or missing", newnews, no)
+				}
+			}
+
+			// only the first time
+			server.AddArticle("test.group", 11, "Subject: old\nDate: Mon, 2 Jan 2006 15:04:05 -0700\n"+
+				"Message-ID: <11@test>\n\nold")
+			if err = FetchArticles(config); err != nil {
+				t.Fatal(err)
+			}
+
+			if !testStore.Has("test.group", "11") {
+				t.Errorf("NEWNEWS %v: fetch-since used for a later fetch", newnews)
+			}
+		}()
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	if age, err := ParseAge("30d"); err != nil || age != 30*24*time.Hour {
+		t.Errorf("30d is %s (%v)", age, err)
+	}
+
+	if age, err := ParseAge("90m"); err != nil || age != 90*time.Minute {
+		t.Errorf("90m is %s (%v)", age, err)
+	}
+
+	if _, err := ParseAge("soon"); err == nil {
+		t.Errorf("„soon“ accepted")
+	}
+}
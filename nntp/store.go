@@ -0,0 +1,292 @@
+package nntp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Where articles are saved, together with what we know about
+// them (watermarks, overview data etc.). Articles are identified
+// by their group and name (see ArticleName); the names of other
+// data start with „.“. The group "" stands for the store as a
+// whole, e. g. for the group list. Reading something that doesn't
+// exist fails with an error satisfying os.IsNotExist.
+type ArticleStore interface {
+	// Saves article under name in group, replacing what was there.
+	Put(group, name string, article RawArticle) error
+
+	// The article saved under name in group.
+	Get(group, name string) (RawArticle, error)
+
+	// The article with Message-ID id in group, and its name.
+	GetById(group string, id MessageId) (RawArticle, string, error)
+
+	// Where the article with Message-ID id is saved (maybe in
+	// several groups).
+	Lookup(id MessageId) ([]IndexEntry, error)
+
+	// The names of all articles saved in group, sorted.
+	List(group string) ([]string, error)
+
+	// The groups something is saved for, sorted (this includes
+	// OUTBOX).
+	Groups() ([]string, error)
+
+	// Do we have the article name in group?
+	Has(group, name string) bool
+
+	// Removes the article (or data) name from group.
+	Delete(group, name string) error
+
+	// The number of the last article fetched from server (see
+	// Servers) into group, or 0.
+	Watermark(group, server string) int
+
+	// See Watermark.
+	SetWatermark(group, server string, no int) error
+
+	// Other data belonging to group, e. g. „.overview“.
+	ReadData(group, name string) ([]byte, error)
+	WriteData(group, name string, data []byte) error
+	AppendData(group, name string, data []byte) error
+}
+
+// An ArticleStore keeping every group in a directory below Root,
+// with one file per article and the data in hidden files next to
+// them. Files are replaced atomically.
+type DirStore struct {
+	Root string // "" is the current directory
+}
+
+// The directory of group. Group and article names often come
+// from the outside (the server, the browser), so this and path
+// fail for anything that could point elsewhere, e. g.
+// „../config.txt“.
+func (d DirStore) dir(group string) (string, error) {
+	if group != "" && !validElement(group) {
+		return "", fmt.Errorf("invalid group name %q", group)
+	}
+
+	return filepath.Join(d.Root, group), nil
+}
+
+// The file under name in group.
+func (d DirStore) path(group, name string) (string, error) {
+	dir, err := d.dir(group)
+	if err != nil {
+		return "", err
+	}
+
+	if !validElement(name) {
+		return "", fmt.Errorf("invalid name %q in group %q", name, group)
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// Can elem be a group or name in a DirStore (a single, relative
+// path element other than „.“ and „..“)?
+func validElement(elem string) bool {
+	return elem != "" && elem != "." && elem != ".." && !strings.ContainsAny(elem, "/\\") &&
+		!filepath.IsAbs(elem)
+}
+
+// Creates group's directory (everyone may read/write it).
+func (d DirStore) mkdir(group string) error {
+	dir, err := d.dir(group)
+	if err != nil || dir == "" {
+		return err
+	}
+
+	return os.MkdirAll(dir, PERM_MASK)
+}
+
+func (d DirStore) Put(group, name string, article RawArticle) error {
+	return d.WriteData(group, name, []byte(article))
+}
+
+func (d DirStore) Get(group, name string) (RawArticle, error) {
+	data, err := d.ReadData(group, name)
+	return RawArticle(data), err
+}
+
+func (d DirStore) GetById(group string, id MessageId) (RawArticle, string, error) {
+	names, err := d.List(group)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, name := range names {
+		article, err := d.Get(group, name)
+		if err != nil {
+			return "", "", err
+		}
+
+		if articleId(string(article)) == id {
+			return article, name, nil
+		}
+	}
+
+	return "", "", os.ErrNotExist
+}
+
+// Reads every group's articles; see IndexedStore for something
+// faster.
+func (d DirStore) Lookup(id MessageId) ([]IndexEntry, error) {
+	groups, err := d.Groups()
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]IndexEntry, 0)
+	for _, group := range groups {
+		if group == OUTBOX {
+			continue
+		}
+
+		_, name, err := d.GetById(group, id)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		no, _ := splitArticleName(name)
+		rv = append(rv, IndexEntry{group, no, name})
+	}
+
+	return rv, nil
+}
+
+func (d DirStore) List(group string) ([]string, error) {
+	dir, err := d.dir(group)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]string, 0, len(info))
+	for _, fileInfo := range info {
+		name := fileInfo.Name()
+
+		// ignore .watermark, half written files etc.
+		if name[0] != '.' && !strings.HasSuffix(name, ".tmp") && !fileInfo.IsDir() {
+			rv = append(rv, name)
+		}
+	}
+
+	return rv, nil
+}
+
+func (d DirStore) Groups() ([]string, error) {
+	root := d.Root
+	if root == "" {
+		root = "."
+	}
+
+	info, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]string, 0)
+	for _, fileInfo := range info {
+		if name := fileInfo.Name(); name[0] != '.' && fileInfo.IsDir() {
+			rv = append(rv, name)
+		}
+	}
+
+	return rv, nil
+}
+
+func (d DirStore) Has(group, name string) bool {
+	path, err := d.path(group, name)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func (d DirStore) Delete(group, name string) error {
+	path, err := d.path(group, name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// Reads the file „group“/.watermark which should contain a
+// number. Every server has its own file (see serverFile).
+func (d DirStore) Watermark(group, server string) int {
+	data, err := d.ReadData(group, serverFile(".watermark", server))
+	if err != nil {
+		return 0
+	}
+
+	return atoi(strings.TrimSpace(string(data)), 0)
+}
+
+func (d DirStore) SetWatermark(group, server string, no int) error {
+	return d.WriteData(group, serverFile(".watermark", server), []byte(strconv.Itoa(no)))
+}
+
+func (d DirStore) ReadData(group, name string) ([]byte, error) {
+	path, err := d.path(group, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+func (d DirStore) WriteData(group, name string, data []byte) error {
+	path, err := d.path(group, name)
+	if err != nil {
+		return err
+	}
+
+	err = d.mkdir(group)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path, data)
+}
+
+func (d DirStore) AppendData(group, name string, data []byte) error {
+	path, err := d.path(group, name)
+	if err != nil {
+		return err
+	}
+
+	err = d.mkdir(group)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, PERM_MASK)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
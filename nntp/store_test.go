@@ -0,0 +1,115 @@
+package nntp
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDirStore(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := DirStore{"spool"}
+	for _, name := range []string{"2", "1"} {
+		err := store.Put("test.group", name, RawArticle("Message-ID: <"+name+"@test>\n\nbody"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.SetWatermark("test.group", "", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := store.List("test.group"); err != nil || !reflect.DeepEqual(names, []string{"1", "2"}) {
+		t.Errorf("listed %v (%v)", names, err)
+	}
+
+	if _, name, err := store.GetById("test.group", "<2@test>"); err != nil || name != "2" {
+		t.Errorf("<2@test> found as %q (%v)", name, err)
+	}
+
+	if _, _, err := store.GetById("test.group", "<3@test>"); !os.IsNotExist(err) {
+		t.Errorf("unknown Message-ID gives %v", err)
+	}
+
+	if err := store.Delete("test.group", "1"); err != nil || store.Has("test.group", "1") {
+		t.Errorf("article 1 not deleted (%v)", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("spool", "test.group", ".watermark")); err != nil {
+		t.Errorf("watermark not saved below the spool root: %s", err)
+	}
+}
+
+// With „spool“, nothing is saved in the current directory.
+func TestSpool(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 3)
+	defer server.Close()
+
+	spool, _ := ioutil.TempDir("", "loread-spool")
+	defer os.RemoveAll(spool)
+
+	config := server.Config()
+	config["groups"] = "test.group"
+	config["spool"] = spool
+	if err := FetchArticles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, _ := ioutil.ReadDir("."); len(info) != 0 {
+		t.Errorf("%s saved in the current directory", info[0].Name())
+	}
+
+	if !(DirStore{spool}).Has("test.group", "3") {
+		t.Errorf("article 3 not saved in the spool")
+	}
+
+	page := get(newState(config), url.Values{"view": {"group"}, "arg": {"test.group"}})
+	if !strings.Contains(page, "article 3") {
+		t.Errorf("group overview doesn't list the spool's articles: %s", page)
+	}
+}
+
+// Names that could point outside the store are refused.
+func TestDirStoreNames(t *testing.T) {
+	defer inTempDir(t)()
+
+	ioutil.WriteFile("config.txt", []byte("pass: secret\n"), 0600)
+	store := DirStore{"spool"}
+	for _, name := range [][2]string{
+		{OUTBOX, "../../config.txt"}, {"..", "config.txt"}, {"../test.group", "1"}, {"test.group", ".."},
+		{"test.group", ""}, {"test.group", "a/b"}, {"/tmp", "1"}, {"test.group", "/tmp/x"}, {".", "1"},
+	} {
+		group, name := name[0], name[1]
+		if _, err := store.Get(group, name); err == nil || os.IsNotExist(err) {
+			t.Errorf("reading %q in %q gives %v", name, group, err)
+		}
+
+		if err := store.Put(group, name, "body"); err == nil {
+			t.Errorf("%q could be written in %q", name, group)
+		}
+
+		if err := store.Delete(group, name); err == nil || store.Has(group, name) {
+			t.Errorf("%q could be deleted in %q", name, group)
+		}
+	}
+
+	if _, err := os.Stat("config.txt"); err != nil {
+		t.Errorf("config.txt is gone: %s", err)
+	}
+
+	if _, err := store.List("../spool"); err == nil {
+		t.Errorf("a group outside the store could be listed")
+	}
+
+	if err := store.WriteData("", ".grouplist", []byte("x")); err != nil {
+		t.Errorf("data at the root can't be written: %s", err)
+	}
+}
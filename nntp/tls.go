@@ -0,0 +1,175 @@
+package nntp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// Values for the „tls“ key in the configuration.
+const (
+	TLS_NONE     = "no"       // plain text (default)
+	TLS_IMPLICIT = "yes"      // NNTPS, i. e. TLS from the beginning
+	TLS_STARTTLS = "starttls" // upgrade using STARTTLS; see RFC 4642
+)
+
+// default ports for plain and implicitly encrypted connections
+const (
+	PORT_NNTP  = "119"
+	PORT_NNTPS = "563"
+)
+
+// used unless the key „timeout“ is given
+const DEFAULT_TIMEOUT = 2 * time.Minute
+
+// Connects to the server given in config and reads its
+// greeting. Depending on config["tls"], the connection is
+// encrypted from the beginning or upgraded via STARTTLS before
+// anything else (in particular, AUTHINFO) is sent.
+func dial(config map[string]string) (Conn, error) {
+	server, port := config["server"], config["port"]
+	mode := config["tls"]
+
+	if mode == "" {
+		mode = TLS_NONE
+	}
+
+	if mode != TLS_NONE && mode != TLS_IMPLICIT && mode != TLS_STARTTLS {
+		return Conn{}, fmt.Errorf("unknown tls mode '%s'", mode)
+	}
+
+	if server == "" {
+		return Conn{}, fmt.Errorf("server not given")
+	}
+
+	if port == "" {
+		port = PORT_NNTP
+		if mode == TLS_IMPLICIT {
+			port = PORT_NNTPS
+		}
+	}
+
+	var tlsConf *tls.Config
+	if mode != TLS_NONE {
+		var err error
+		tlsConf, err = tlsConfig(config)
+		if err != nil {
+			return Conn{}, err
+		}
+	}
+
+	timeout, err := time.ParseDuration(config["timeout"])
+	if err != nil {
+		timeout = DEFAULT_TIMEOUT
+	}
+
+	addr := net.JoinHostPort(server, port)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	// maybe through a proxy
+	raw, err := dialTCP(config, dialer, addr)
+	if err != nil {
+		return Conn{}, err
+	}
+
+	if mode == TLS_IMPLICIT {
+		encrypted := tls.Client(raw, tlsConf)
+		encrypted.SetDeadline(time.Now().Add(timeout))
+		err = encrypted.Handshake()
+		if err != nil {
+			raw.Close()
+			return Conn{}, err
+		}
+
+		encrypted.SetDeadline(time.Time{})
+		raw = encrypted
+	}
+
+	_, verbose := config["verbose"]
+	conn := Conn{
+		intern:  textproto.NewConn(raw),
+		raw:     raw,
+		verbose: verbose,
+		timeout: timeout,
+	}
+
+	// say hello
+	_, _, err = conn.ReadCodeLine(HELLO / 10) // 200 or 201
+	if err != nil {
+		conn.Close()
+		return Conn{}, err
+	}
+
+	if mode == TLS_STARTTLS {
+		conn, err = startTLS(conn, tlsConf)
+		if err != nil {
+			conn.Close()
+			return Conn{}, err
+		}
+	}
+
+	return conn, nil
+}
+
+// Negotiates TLS on an established plain text connection; see
+// RFC 4642. The returned Conn replaces conn.
+func startTLS(conn Conn, tlsConf *tls.Config) (Conn, error) {
+	_, err := conn.Cmd("STARTTLS")
+	if err != nil {
+		return conn, err
+	}
+
+	_, _, err = conn.ReadCodeLine(CONTINUE_TLS)
+	if err != nil {
+		return conn, err
+	}
+
+	// a server that stalls here mustn't hang us (see dial)
+	encrypted := tls.Client(conn.raw, tlsConf)
+	if conn.timeout > 0 {
+		encrypted.SetDeadline(time.Now().Add(conn.timeout))
+	}
+
+	err = encrypted.Handshake()
+	if err != nil {
+		return conn, err
+	}
+
+	encrypted.SetDeadline(time.Time{})
+	conn.intern, conn.raw = textproto.NewConn(encrypted), encrypted
+	return conn, nil
+}
+
+// Builds the TLS configuration from the keys „tls-ca-file“ (PEM
+// file with additional trusted certificates) and
+// „tls-insecure“ (don't verify the server's certificate at all).
+func tlsConfig(config map[string]string) (*tls.Config, error) {
+	rv := &tls.Config{
+		ServerName:         config["server"],
+		InsecureSkipVerify: config["tls-insecure"] == "yes",
+	}
+
+	if file := config["tls-ca-file"]; file != "" {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+
+		rv.RootCAs = pool
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,263 @@
+package nntp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Creates a self-signed certificate for 127.0.0.1 and writes it
+// (PEM encoded) to a file in dir, so it can be used as
+// „tls-ca-file“.
+func selfSignedCert(t *testing.T, dir string) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "loread test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(file, certPEM, PERM_MASK)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, file
+}
+
+// A minimal server that greets, optionally upgrades via
+// STARTTLS and accepts AUTHINFO. It reports on „encrypted“
+// whether the password arrived over TLS.
+func tlsStandIn(ln net.Listener, tlsConf *tls.Config, encrypted chan<- bool) {
+	raw, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer raw.Close()
+
+	_, isTLS := raw.(*tls.Conn)
+	conn := textproto.NewConn(raw)
+	conn.PrintfLine("200 stand-in ready")
+
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case line == "STARTTLS":
+			conn.PrintfLine("382 continue with TLS negotiation")
+			encryptedConn := tls.Server(raw, tlsConf)
+			if encryptedConn.Handshake() != nil {
+				return
+			}
+
+			conn = textproto.NewConn(encryptedConn)
+			isTLS = true
+
+		case len(line) > 14 && line[:14] == "AUTHINFO USER ":
+			conn.PrintfLine("381 password required")
+
+		case len(line) > 14 && line[:14] == "AUTHINFO PASS ":
+			encrypted <- isTLS
+			conn.PrintfLine("281 authentication accepted")
+
+		case line == "QUIT":
+			conn.PrintfLine("205 bye")
+			return
+
+		default:
+			conn.PrintfLine("500 unknown command")
+		}
+	}
+}
+
+// Dials with config and authenticates; returns whether the
+// stand-in saw an encrypted password.
+func dialStandIn(t *testing.T, config map[string]string, ln net.Listener, tlsConf *tls.Config) bool {
+	encrypted := make(chan bool, 1)
+	go tlsStandIn(ln, tlsConf, encrypted)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	config["server"], config["port"] = host, port
+
+	conn, err := dial(config)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Cmd("AUTHINFO USER %s", "user")
+	if _, _, err := conn.ReadCodeLine(PASSWORD_REQUIRED); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Cmd("AUTHINFO PASS %s", "secret")
+	if _, _, err := conn.ReadCodeLine(AUTHEN_ACCEPTED); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Cmd("QUIT")
+	return <-encrypted
+}
+
+func TestImplicitTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "loread")
+	defer os.RemoveAll(dir)
+	cert, caFile := selfSignedCert(t, dir)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	config := map[string]string{"tls": TLS_IMPLICIT, "tls-ca-file": caFile}
+	if !dialStandIn(t, config, ln, tlsConf) {
+		t.Errorf("password was sent unencrypted")
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "loread")
+	defer os.RemoveAll(dir)
+	cert, caFile := selfSignedCert(t, dir)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	config := map[string]string{"tls": TLS_STARTTLS, "tls-ca-file": caFile}
+	if !dialStandIn(t, config, ln, tlsConf) {
+		t.Errorf("password was sent unencrypted")
+	}
+}
+
+func TestTLSInsecure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "loread")
+	defer os.RemoveAll(dir)
+	cert, _ := selfSignedCert(t, dir)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// without our CA, the self-signed certificate must be rejected
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	config := map[string]string{"server": host, "port": port, "tls": TLS_IMPLICIT}
+	if conn, err := dial(config); err == nil {
+		conn.Close()
+		t.Fatalf("untrusted certificate was accepted")
+	}
+
+	// unless we explicitly ask for it
+	config = map[string]string{"tls": TLS_IMPLICIT, "tls-insecure": "yes"}
+	if !dialStandIn(t, config, ln, tlsConf) {
+		t.Errorf("password was sent unencrypted")
+	}
+}
+
+// A server that agrees to STARTTLS but never negotiates runs into
+// the timeout instead of hanging us.
+func TestStartTLSStalled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		raw, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer raw.Close()
+
+		conn := textproto.NewConn(raw)
+		conn.PrintfLine("200 stand-in ready")
+		if line, _ := conn.ReadLine(); line == "STARTTLS" {
+			conn.PrintfLine("382 continue with TLS negotiation")
+		}
+		<-stop
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	config := map[string]string{"server": host, "port": port, "tls": TLS_STARTTLS, "timeout": "200ms"}
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := dial(config)
+		if err == nil {
+			conn.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("stalled handshake succeeded")
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stalled handshake didn't time out")
+	}
+}
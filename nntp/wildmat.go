@@ -0,0 +1,197 @@
+package nntp
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// file in which FetchArticles saves which groups the subscribed
+// wildmats matched
+const EXPANDED_SUBSCRIPTIONS = ".subscribed"
+
+// Does name match wildmat (see RFC 3977, 4)? A wildmat is a comma
+// separated list of patterns, where „*“ matches any sequence of
+// characters and „?“ a single one. The last pattern matching name
+// decides: if it starts with „!“, name doesn't match.
+func MatchWildmat(wildmat, name string) bool {
+	rv := false
+	for _, pattern := range strings.Split(wildmat, ",") {
+		pattern = TrimWhite(pattern)
+		negated := strings.HasPrefix(pattern, "!")
+		if matchPattern([]rune(strings.TrimPrefix(pattern, "!")), []rune(name)) {
+			rv = !negated
+		}
+	}
+
+	return rv
+}
+
+// a single pattern without „!“ and „,“
+func matchPattern(pattern, name []rune) bool {
+	// where to continue if the last „*“ should match one more
+	// character
+	star, retry := -1, 0
+	p, n := 0, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, retry = p, n
+			p++
+
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+
+		case star >= 0:
+			retry++
+			p, n = star+1, retry
+
+		default:
+			return false
+		}
+	}
+
+	// only „*“ may be left over
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// Is pattern more than a group name?
+func isWildmat(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?!")
+}
+
+// Expands the subscriptions (group names or wildmat patterns, see
+// ReadSubscriptions) against the server's LIST ACTIVE. The result
+// is saved in store for SubscribedGroups; server is the section's
+// name (see Servers).
+func ExpandSubscriptions(client *Client, store ArticleStore, server string, patterns []string) ([]string, error) {
+	candidates := make([]string, 0)
+	wildmats := make([]string, 0)
+	for _, pattern := range patterns {
+		if isWildmat(pattern) {
+			wildmats = append(wildmats, pattern)
+		} else {
+			candidates = append(candidates, pattern)
+		}
+	}
+
+	if len(wildmats) > 0 {
+		// the server may filter, but needn't
+		active, err := client.ListActive(strings.Join(wildmats, ","))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range active {
+			candidates = append(candidates, group.Name)
+		}
+	}
+
+	groups := matching(patterns, candidates)
+	return groups, store.WriteData("", serverFile(EXPANDED_SUBSCRIPTIONS, server), []byte(strings.Join(groups, "\n")+"\n"))
+}
+
+// Like ExpandSubscriptions, but on its own connection. Without
+// wildmats, there's no need to ask the server.
+func expandSubscriptions(config map[string]string, patterns []string) ([]string, error) {
+	wildmats := false
+	for _, pattern := range patterns {
+		wildmats = wildmats || isWildmat(pattern)
+	}
+
+	if !wildmats {
+		return patterns, nil
+	}
+
+	client, err := connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	defer client.Close()
+
+	groups, err := ExpandSubscriptions(client, OpenStore(config), config["section"], patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Quit()
+	return groups, nil
+}
+
+// The subscribed groups, with wildmat patterns expanded as far as
+// we know without asking the server: against the last expansion
+// by FetchArticles and our copy of the group list. With several
+// servers (see Servers), these are the groups subscribed on any
+// of them.
+func SubscribedGroups(config map[string]string) ([]string, error) {
+	if config["sections"] != "" {
+		all := make([]string, 0)
+		for _, server := range Servers(config) {
+			groups, err := SubscribedGroups(server)
+			if err != nil {
+				return nil, err
+			}
+
+			all = append(all, groups...)
+		}
+
+		return matching([]string{"*"}, all), nil
+	}
+
+	patterns, err := ReadSubscriptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]string, 0)
+	for _, pattern := range patterns {
+		if !isWildmat(pattern) {
+			candidates = append(candidates, pattern)
+		}
+	}
+
+	if len(candidates) == len(patterns) {
+		return patterns, nil
+	}
+
+	store := OpenStore(config)
+	data, err := store.ReadData("", serverFile(EXPANDED_SUBSCRIPTIONS, config["section"]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	candidates = append(candidates, strings.Fields(string(data))...)
+
+	list, err := ReadGroupList(store)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range list {
+		candidates = append(candidates, group.Name)
+	}
+
+	return matching(patterns, candidates), nil
+}
+
+// The candidates matching patterns (as a wildmat), sorted and
+// without duplicates.
+func matching(patterns, candidates []string) []string {
+	wildmat := strings.Join(patterns, ",")
+	sort.Strings(candidates)
+
+	rv := make([]string, 0)
+	for i, group := range candidates {
+		if (i == 0 || candidates[i-1] != group) && MatchWildmat(wildmat, group) {
+			rv = append(rv, group)
+		}
+	}
+
+	return rv
+}
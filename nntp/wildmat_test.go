@@ -0,0 +1,78 @@
+package nntp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchWildmat(t *testing.T) {
+	tests := []struct {
+		wildmat, name string
+		match         bool
+	}{
+		{"comp.lang.lisp", "comp.lang.lisp", true},
+		{"comp.lang.lisp", "comp.lang.lis", false},
+		{"comp.lang.*", "comp.lang.lisp", true},
+		{"comp.lang.*", "comp.lang", false},
+		{"comp.*.lisp", "comp.lang.lisp", true},
+		{"comp.lang.?isp", "comp.lang.lisp", true},
+		{"comp.lang.?isp", "comp.lang.isp", false},
+		{"*", "", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"comp.lang.*,!comp.lang.java.*", "comp.lang.java.help", false},
+		{"comp.lang.*,!comp.lang.java.*", "comp.lang.lisp", true},
+		{"comp.lang.*, !comp.lang.java.*, comp.lang.java.help", "comp.lang.java.help", true},
+		{"!comp.lang.lisp", "comp.lang.lisp", false},
+		{"de.*,!de.alt.*", "rec.games", false},
+	}
+
+	for _, test := range tests {
+		if MatchWildmat(test.wildmat, test.name) != test.match {
+			t.Errorf("MatchWildmat(%q, %q) should be %v", test.wildmat, test.name, test.match)
+		}
+	}
+}
+
+func TestExpandSubscriptions(t *testing.T) {
+	defer inTempDir(t)()
+
+	server := newTestServer(t, 1)
+	defer server.Close()
+	for _, group := range []string{"comp.lang.lisp", "comp.lang.java.help", "rec.games.go"} {
+		server.AddGroup(group, "", time.Now())
+	}
+
+	config := server.Config()
+	config["groups"] = "comp.lang.*,!comp.lang.java.*, test.group"
+
+	client, err := connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	patterns, _ := ReadSubscriptions(config)
+	groups, err := ExpandSubscriptions(client, testStore, "", patterns)
+	if err != nil || strings.Join(groups, " ") != "comp.lang.lisp test.group" {
+		t.Errorf("expanded to %v (%v)", groups, err)
+	}
+
+	// known without asking the server
+	groups, err = SubscribedGroups(config)
+	if err != nil || strings.Join(groups, " ") != "comp.lang.lisp test.group" {
+		t.Errorf("subscribed to %v (%v)", groups, err)
+	}
+
+	// excluded explicitly, since the wildmat still matches
+	patterns, err = Unsubscribe(config, "comp.lang.lisp")
+	if err != nil || patterns[len(patterns)-1] != "!comp.lang.lisp" {
+		t.Errorf("unsubscribing gives %v (%v)", patterns, err)
+	}
+
+	groups, _ = SubscribedGroups(config)
+	if strings.Join(groups, " ") != "test.group" {
+		t.Errorf("subscribed to %v after unsubscribing", groups)
+	}
+}